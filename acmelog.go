@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"9fans.net/go/acme"
+	"9fans.net/go/plan9/client"
+)
+
+// maxBackoff is the longest wait between attempts to reach acme.
+const maxBackoff = 30 * time.Second
+
+// waitAcme returns once acme can be reached, retrying with backoff
+// while it cannot, as before it starts or while it restarts.
+func waitAcme() {
+	delay := time.Second
+	for {
+		c, err := client.DialService("acme")
+		if err == nil {
+			c.Close()
+			return
+		}
+		log.Printf("acme: %v; retrying in %s", err, delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+}
+
+// readLog sends acme's log events to events. When acme goes away it
+// waits for it to come back and restarts acmewatch, since the acme
+// package cannot connect a second time.
+func readLog(events chan<- acme.LogEvent) {
+	waitAcme()
+	l, err := acme.Log()
+	if err != nil {
+		log.Printf("acme log: %v", err)
+		reconnect()
+	}
+	for {
+		event, err := l.Read()
+		if err != nil {
+			log.Printf("acme log: %v", err)
+			l.Close()
+			reconnect()
+		}
+		if logBus.active() {
+			logBus.send([]byte(fmt.Sprintf("%d %s %s\n", event.ID, event.Op, event.Name)))
+		}
+		events <- event
+	}
+}
+
+// reconnect waits for acme and then restarts acmewatch with the same
+// arguments, saving its state first for -dump.
+func reconnect() {
+	saveOnExit()
+	waitAcme()
+	if err := restart(); err != nil {
+		log.Fatalf("restart: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// diagRe matches a diagnostic line beginning with file:line or
+// file:line:col.
+var diagRe = regexp.MustCompile(`^([^:\s]+|<standard input>):(\d+)(?::(\d+))?(:.*)?$`)
+
+// rewriteAddresses rewrites the addresses at the start of each line of
+// diag, output by a tool run on name, in style, set by the address
+// config: "line" (file:line), "col" (file:line:col), or "offset"
+// (file:#n, a rune offset acme can jump to). File names are made
+// absolute so they can be plumbed from any window. With no style diag
+// is returned unchanged.
+func rewriteAddresses(style, name, diag string) string {
+	if style == "" || diag == "" {
+		return diag
+	}
+	contents := map[string][]byte{}
+	lines := strings.Split(diag, "\n")
+	for i, line := range lines {
+		m := diagRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		file := m[1]
+		switch {
+		case file == "<standard input>" || file == "-" || file == "stdin":
+			file = name
+		case !filepath.IsAbs(file):
+			file = filepath.Join(filepath.Dir(name), file)
+		}
+		ln, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		var addr string
+		switch style {
+		case "line":
+			addr = fmt.Sprintf("%s:%d", file, ln)
+		case "col":
+			if col > 0 {
+				addr = fmt.Sprintf("%s:%d:%d", file, ln, col)
+			} else {
+				addr = fmt.Sprintf("%s:%d", file, ln)
+			}
+		case "offset":
+			b, ok := contents[file]
+			if !ok {
+				b, _ = ioutil.ReadFile(file)
+				contents[file] = b
+			}
+			addr = fmt.Sprintf("%s:#%d", file, runeOffset(b, ln, col))
+		default:
+			return diag
+		}
+		lines[i] = addr + m[4]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// runeOffset returns the rune offset in text of line ln (1-based) and
+// column col (1-based byte column, or 0 for the start of the line).
+func runeOffset(text []byte, ln, col int) int {
+	off := 0
+	for ln > 1 && len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		text = text[size:]
+		off++
+		if r == '\n' {
+			ln--
+		}
+	}
+	if col > 1 {
+		if col-1 < len(text) {
+			text = text[:col-1]
+		}
+		off += utf8.RuneCount(text)
+	}
+	return off
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteAddresses(t *testing.T) {
+	const name = "/src/a.go"
+	for _, tt := range []struct {
+		style, diag, want string
+	}{
+		{"", "a.go:3:5: bad\n", "a.go:3:5: bad\n"},
+		{"line", "", ""},
+		{"line", "a.go:3:5: bad\n", "/src/a.go:3: bad\n"},
+		{"col", "a.go:3:5: bad\n", "/src/a.go:3:5: bad\n"},
+		{"col", "a.go:3: bad\n", "/src/a.go:3: bad\n"},
+		{"line", "<standard input>:2:1: bad", "/src/a.go:2: bad"},
+		{"line", "-:2: bad", "/src/a.go:2: bad"},
+		{"line", "sub/b.go:7: bad", "/src/sub/b.go:7: bad"},
+		{"line", "/abs/c.go:7:2: bad", "/abs/c.go:7: bad"},
+		{"line", "no address here\n\tor here", "no address here\n\tor here"},
+		{"line", "a.go:1: one\nnote\na.go:2: two", "/src/a.go:1: one\nnote\n/src/a.go:2: two"},
+		{"bogus", "a.go:1: bad", "a.go:1: bad"},
+	} {
+		if got := rewriteAddresses(tt.style, name, tt.diag); got != tt.want {
+			t.Errorf("rewriteAddresses(%q, %q, %q) = %q, want %q", tt.style, name, tt.diag, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteAddressesOffset(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.go")
+	if err := ioutil.WriteFile(name, []byte("ab\nçd\nef\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ diag, want string }{
+		{"a.go:1: bad", name + ":#0: bad"},
+		{"a.go:2: bad", name + ":#3: bad"},
+		{"a.go:3:2: bad", name + ":#7: bad"},
+		// Columns count bytes, offsets runes.
+		{"a.go:2:3: bad", name + ":#4: bad"},
+	} {
+		if got := rewriteAddresses("offset", name, tt.diag); got != tt.want {
+			t.Errorf("rewriteAddresses(offset, %q) = %q, want %q", tt.diag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// annWindows holds the open +Ann windows by file name. It is used only
+// by the main loop.
+var annWindows = map[string]*acme.Win{}
+
+// commitRe matches a commit hash as git blame prints it, with a ^ for
+// boundary commits.
+var commitRe = regexp.MustCompile(`^\^?([0-9a-f]{7,40})$`)
+
+// annotate is the ann control command. It shows git blame for the lines
+// of dot in window id, given as its argument, in the file's +Ann
+// window. Looking (button 3) at a commit hash there opens git show of
+// the commit.
+func annotate(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: ann winid")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "", fmt.Errorf("bad window id %q", args[0])
+	}
+	name, err := winName(id)
+	if err != nil {
+		return "", err
+	}
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return "", err
+	}
+	defer w.CloseFiles()
+	body, err := w.ReadAll("body")
+	if err != nil {
+		return "", err
+	}
+	if err := w.Ctl("addr=dot"); err != nil {
+		return "", err
+	}
+	q0, q1, err := w.ReadAddr()
+	if err != nil {
+		return "", err
+	}
+	l0, l1 := lineRange(body, q0, q1)
+	go func() {
+		// Blame the window's body, so the lines match even when it
+		// has unsaved changes.
+		cmd := exec.Command("git", "blame", "--date=short", "-L", fmt.Sprintf("%d,%d", l0, l1),
+			"--contents", "-", "--", filepath.Base(name))
+		cmd.Dir = filepath.Dir(name)
+		cmd.Stdin = bytes.NewReader(body)
+		out, err := cmd.CombinedOutput()
+		mainFuncs <- func() {
+			if err != nil {
+				emitError(name, fmt.Errorf("git blame: %v\n%s", err, out))
+				return
+			}
+			showAnn(name, out)
+		}
+	}()
+	return "ok", nil
+}
+
+// winName returns the name of window id.
+func winName(id int) (string, error) {
+	wins, err := acme.Windows()
+	if err != nil {
+		return "", err
+	}
+	for _, wi := range wins {
+		if wi.ID == id {
+			return wi.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no window %d", id)
+}
+
+// lineRange returns the lines, counted from 1, holding the runes q0
+// through q1 of body. A selection ending at the start of a line does
+// not include it, and dot past the final newline is on the last line.
+func lineRange(body []byte, q0, q1 int) (int, int) {
+	text := []rune(string(body))
+	if q1 > len(text) {
+		q1 = len(text)
+	}
+	if q0 > q1 {
+		q0 = q1
+	}
+	if q1 > q0 && text[q1-1] == '\n' {
+		q1--
+	}
+	l0 := strings.Count(string(text[:q0]), "\n") + 1
+	l1 := l0 + strings.Count(string(text[q0:q1]), "\n")
+	if n := strings.Count(string(text), "\n"); n > 0 && text[len(text)-1] == '\n' && l0 > n {
+		l0, l1 = n, n
+	}
+	return l0, l1
+}
+
+// showAnn shows blame, the git blame output for name, in its +Ann
+// window.
+func showAnn(name string, blame []byte) {
+	w := annWindows[name]
+	if w == nil {
+		var err error
+		if w, err = newWindow(name + "+Ann"); err != nil {
+			emitError(name, err)
+			return
+		}
+		annWindows[name] = w
+		go annEvents(name, w)
+	}
+	w.Addr(",")
+	w.Write("data", blame)
+	w.Ctl("clean")
+	w.Addr("#0")
+	w.Ctl("dot=addr")
+	w.Ctl("show")
+}
+
+// annEvents handles the events of the +Ann window of name, opening
+// commits looked at and passing other events back to acme.
+func annEvents(name string, w *acme.Win) {
+	for e := range w.EventChan() {
+		if e.C2 == 'l' || e.C2 == 'L' {
+			if m := commitRe.FindStringSubmatch(strings.TrimSpace(string(e.Text))); m != nil {
+				hash := m[1]
+				go showCommit(filepath.Dir(name), hash)
+				continue
+			}
+		}
+		w.WriteEvent(e)
+	}
+	mainFuncs <- func() { delete(annWindows, name) }
+}
+
+// showCommit opens git show of the commit hash, of the repository
+// holding dir, in a window of its own.
+func showCommit(dir, hash string) {
+	cmd := exec.Command("git", "show", hash)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	mainFuncs <- func() {
+		if err != nil {
+			emitError(dir, fmt.Errorf("git show %s: %v\n%s", hash, err, out))
+			return
+		}
+		wname := filepath.Join(dir, "+git", hash)
+		w := acme.Show(wname)
+		if w == nil {
+			if w, err = newWindow(wname); err != nil {
+				emitError(dir, err)
+				return
+			}
+		}
+		w.Addr(",")
+		w.Write("data", out)
+		w.Ctl("clean")
+		w.Addr("#0")
+		w.Ctl("dot=addr")
+		w.Ctl("show")
+	}
+}
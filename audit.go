@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"9fans.net/go/acme"
+)
+
+var bom = []byte("\xef\xbb\xbf")
+
+// audit compares invariant properties of the window body after a
+// reformat against the formatter output and reports any anomalies.
+// A mismatch here means the patcher, not the formatter, is wrong.
+func audit(w *acme.Win, name string, old, new []byte) {
+	body, err := w.ReadAll("body")
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	var problems []string
+	if have, want := bytes.HasPrefix(body, bom), bytes.HasPrefix(new, bom); have != want {
+		problems = append(problems, fmt.Sprintf("BOM present: have %v, want %v", have, want))
+	}
+	if have, want := bytes.HasSuffix(body, []byte("\n")), bytes.HasSuffix(new, []byte("\n")); have != want {
+		problems = append(problems, fmt.Sprintf("final newline: have %v, want %v", have, want))
+	}
+	if have, want := lineCount(body)-lineCount(old), lineCount(new)-lineCount(old); have != want {
+		problems = append(problems, fmt.Sprintf("line count delta: have %+d, want %+d", have, want))
+	}
+	if len(problems) == 0 && !bytes.Equal(body, new) {
+		problems = append(problems, "body differs from formatter output")
+	}
+	for _, p := range problems {
+		emit(Event{Event: "audit", File: name, Outcome: "failed", Message: "audit: " + p})
+	}
+}
+
+// lineCount returns the number of lines in text, counting a final
+// unterminated line.
+func lineCount(text []byte) int {
+	n := bytes.Count(text, []byte("\n"))
+	if len(text) > 0 && text[len(text)-1] != '\n' {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// bazelRoots mark the root of a Bazel workspace.
+var bazelRoots = []string{"MODULE.bazel", "WORKSPACE", "WORKSPACE.bazel"}
+
+// buildifier formats a Bazel file with buildifier, by the file type its
+// name implies.
+func buildifier(ctx context.Context, fm *Formatter, name string, src []byte) ([]byte, error) {
+	typ := "build"
+	switch base := filepath.Base(name); {
+	case strings.HasSuffix(base, ".bzl"):
+		typ = "bzl"
+	case base == "MODULE.bazel":
+		typ = "module"
+	case strings.HasPrefix(base, "WORKSPACE"):
+		typ = "workspace"
+	}
+	c := Command{Cmd: "buildifier", Args: []string{"-type=" + typ, "-path=" + name}, Stdout: true}
+	return pipe(ctx, name, src, []Command{c})
+}
+
+// buildozerRe matches the buildozer commands Bazel suggests for build
+// errors like missing dependencies.
+var buildozerRe = regexp.MustCompile(`buildozer '[^']*'( [^ ']+)+`)
+
+// buildozer builds the package containing name and returns the fixes
+// Bazel suggests as command lines that can be executed from acme, each
+// changing into the workspace first. Without suggestions it returns
+// the build's output.
+func buildozer(ctx context.Context, h *Hook, name string) ([]byte, error) {
+	dir := filepath.Dir(name)
+	root := projectRoot(dir, bazelRoots)
+	pkg, err := filepath.Rel(root, dir)
+	if err != nil {
+		return nil, err
+	}
+	if pkg == "." {
+		pkg = ""
+	}
+	c := Command{Cmd: "bazel", Args: []string{"build", "--keep_going", "//" + filepath.ToSlash(pkg) + ":all"}, Dir: root}
+	out, err := c.runContext(ctx, name, name, nil)
+	if err == nil {
+		return nil, nil
+	}
+	var b strings.Builder
+	seen := map[string]bool{}
+	for _, fix := range buildozerRe.FindAllString(string(out), -1) {
+		if !seen[fix] {
+			seen[fix] = true
+			fmt.Fprintf(&b, "cd %s && %s\n", root, fix)
+		}
+	}
+	if b.Len() == 0 {
+		return out, err
+	}
+	return []byte(b.String()), err
+}
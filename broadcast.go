@@ -0,0 +1,52 @@
+package main
+
+import "sync"
+
+// A broadcaster sends lines to any number of subscribers. A subscriber
+// that falls behind loses lines rather than blocking the sender.
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[chan []byte]bool
+}
+
+var (
+	// eventBus carries processed events as JSON lines.
+	eventBus broadcaster
+	// logBus carries the raw acme log.
+	logBus broadcaster
+)
+
+func (b *broadcaster) subscribe() chan []byte {
+	c := make(chan []byte, 100)
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = map[chan []byte]bool{}
+	}
+	b.subs[c] = true
+	b.mu.Unlock()
+	return c
+}
+
+func (b *broadcaster) unsubscribe(c chan []byte) {
+	b.mu.Lock()
+	delete(b.subs, c)
+	b.mu.Unlock()
+}
+
+// active reports whether b has subscribers.
+func (b *broadcaster) active() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs) > 0
+}
+
+func (b *broadcaster) send(line []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.subs {
+		select {
+		case c <- line:
+		default:
+		}
+	}
+}
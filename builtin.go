@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// builtins maps the names of builtin formatters to their functions,
+// which return the formatted contents of the file name given its
+// contents src.
+var builtins = map[string]func(ctx context.Context, fm *Formatter, name string, src []byte) ([]byte, error){
+	"bazel":         buildifier,
+	"cue":           commandBuiltin(cueFmt),
+	"dhall":         commandBuiltin(dhallFmt),
+	"include_guard": includeGuard,
+	"jsonnet":       commandBuiltin(jsonnetFmt),
+	"latex":         latexindent,
+	"python":        python,
+	"rust":          rustfmt,
+	"shell":         shfmt,
+}
+
+// hookBuiltins maps the names of builtin hooks to their functions,
+// which return diagnostics for the file name. They stop when ctx is
+// done.
+var hookBuiltins = map[string]func(ctx context.Context, h *Hook, name string) ([]byte, error){
+	"buildozer":   buildozer,
+	"clippy":      clippy,
+	"ctags":       ctags,
+	"latexmk":     latexmk,
+	"line_length": lineLength,
+	"render":      render,
+	"shellcheck":  shellcheck,
+}
+
+// pipe runs each command in turn on src, passing each the previous
+// one's output, and returns the last output. On failure it returns the
+// failing command's output. The commands are killed if ctx is done
+// first.
+func pipe(ctx context.Context, name string, src []byte, cmds []Command) ([]byte, error) {
+	for _, c := range cmds {
+		out, err := c.runContext(ctx, name, name, bytes.NewReader(src))
+		if err != nil {
+			return out, fmt.Errorf("%s: %v", c.Cmd, err)
+		}
+		src = out
+	}
+	return src, nil
+}
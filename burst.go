@@ -0,0 +1,75 @@
+package main
+
+import (
+	"time"
+
+	"9fans.net/go/acme"
+)
+
+type burst struct {
+	times []time.Time
+	put   *acme.LogEvent
+	timer *time.Timer
+}
+
+var (
+	bursts    = map[int]*burst{}
+	burstDone = make(chan int)
+)
+
+// deferBurst records event and reports whether it is a put that is
+// part of a burst of events on its window. Such a put is held until the
+// burst ends, at which point its id is sent on burstDone. Other events,
+// such as a get whose contents must be filtered, are never held.
+func deferBurst(event acme.LogEvent) bool {
+	if config.Burst.Events <= 0 || event.ID == 0 {
+		return false
+	}
+	if event.Op == "del" {
+		if b := bursts[event.ID]; b != nil && b.timer != nil {
+			b.timer.Stop()
+		}
+		delete(bursts, event.ID)
+		return false
+	}
+	b := bursts[event.ID]
+	if b == nil {
+		b = new(burst)
+		bursts[event.ID] = b
+	}
+	now := time.Now()
+	times := b.times[:0]
+	for _, t := range b.times {
+		if now.Sub(t) < config.Burst.Within {
+			times = append(times, t)
+		}
+	}
+	b.times = append(times, now)
+	if len(b.times) < config.Burst.Events && b.put == nil {
+		return false
+	}
+	if event.Op == "put" {
+		e := event
+		b.put = &e
+	}
+	if b.put != nil {
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+		id := event.ID
+		b.timer = time.AfterFunc(config.Burst.Quiet, func() { burstDone <- id })
+	}
+	return event.Op == "put"
+}
+
+// endBurst returns the put deferred for window id, if any.
+func endBurst(id int) (acme.LogEvent, bool) {
+	b := bursts[id]
+	if b == nil || b.put == nil || time.Since(b.times[len(b.times)-1]) < config.Burst.Quiet {
+		// A later event restarted the timer.
+		return acme.LogEvent{}, false
+	}
+	event := *b.put
+	delete(bursts, id)
+	return event, true
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"9fans.net/go/acme"
+)
+
+// Clipboard configures how the copy commands reach the system
+// clipboard.
+type Clipboard struct {
+	// Method is "auto" (the default), "command" to run Cmd, or "osc52"
+	// to write an OSC 52 escape sequence to TTY, which terminals, even
+	// at the far end of an SSH connection, turn into a copy.
+	Method string
+	Command
+	// TTY is the terminal OSC 52 sequences are written to. Defaults to
+	// /dev/tty.
+	TTY string
+}
+
+// clipboardTools are the clipboard commands tried, in order, by the
+// auto method.
+var clipboardTools = []Command{
+	{Cmd: "pbcopy"},
+	{Cmd: "wl-copy"},
+	{Cmd: "xclip", Args: []string{"-selection", "clipboard"}},
+	{Cmd: "xsel", Args: []string{"--clipboard", "--input"}},
+}
+
+// lastOutput holds the last output printed for each file, for the
+// copy command. It is guarded by outputMu.
+var lastOutput = map[string]string{}
+
+// check validates c.
+func (c *Clipboard) check() error {
+	switch c.Method {
+	case "", "auto", "osc52":
+	case "command":
+		if c.Cmd == "" {
+			return errors.New("clipboard: method command needs cmd")
+		}
+	default:
+		return fmt.Errorf("clipboard: unknown method %q", c.Method)
+	}
+	c.expand()
+	return nil
+}
+
+// copyText puts text on the clipboard. The auto method runs cmd if
+// set, uses OSC 52 in an SSH session, and otherwise runs the first
+// clipboard tool found, falling back to OSC 52.
+func copyText(text []byte) error {
+	configMu.RLock()
+	c := config.Clipboard
+	configMu.RUnlock()
+	switch c.Method {
+	case "osc52":
+		return osc52(c.TTY, text)
+	case "command":
+		return runClipboard(c.Command, text)
+	}
+	if c.Cmd != "" {
+		return runClipboard(c.Command, text)
+	}
+	if os.Getenv("SSH_TTY") == "" && os.Getenv("SSH_CONNECTION") == "" {
+		for _, t := range clipboardTools {
+			if _, err := exec.LookPath(t.Cmd); err == nil {
+				return runClipboard(t, text)
+			}
+		}
+	}
+	return osc52(c.TTY, text)
+}
+
+// runClipboard runs c with text on stdin. Its output is not
+// collected: tools like xclip stay behind to serve the selection.
+func runClipboard(c Command, text []byte) error {
+	home, _ := os.UserHomeDir()
+	bin, err := lookCmd(c.Cmd, home)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(bin, c.Args...)
+	cmd.Stdin = bytes.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %v", c.Cmd, err)
+	}
+	return nil
+}
+
+// osc52 writes text to tty as an OSC 52 clipboard escape sequence.
+func osc52(tty string, text []byte) error {
+	if tty == "" {
+		tty = "/dev/tty"
+	}
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString(text) + "\a"
+	if os.Getenv("TMUX") != "" {
+		// Pass the sequence through tmux to the outer terminal.
+		seq = "\x1bPtmux;\x1b" + seq + "\x1b\\"
+	}
+	return ioutil.WriteFile(tty, []byte(seq), 0)
+}
+
+// copyOutput is the copy control command. It copies the last output
+// printed for a file, such as a formatter's or linter's diagnostics.
+func copyOutput(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: copy file")
+	}
+	outputMu.Lock()
+	text, ok := lastOutput[args[0]]
+	outputMu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("no output for %s", args[0])
+	}
+	return "ok", copyText([]byte(text))
+}
+
+// copySelection is the copysel control command. It copies the
+// selection of window id, given as its argument.
+func copySelection(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: copysel winid")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "", fmt.Errorf("bad window id %q", args[0])
+	}
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return "", err
+	}
+	defer w.CloseFiles()
+	if err := w.Ctl("addr=dot"); err != nil {
+		return "", err
+	}
+	text, err := w.ReadAll("xdata")
+	if err != nil {
+		return "", err
+	}
+	return "ok", copyText(text)
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Command is the command run by a rule.
+type Command struct {
+	Cmd  string
+	Args []string
+	// Dir is the working directory. It defaults to the directory of
+	// the file; a relative Dir is relative to that directory.
+	Dir string
+	// VersionArgs are the arguments that make Cmd print its version.
+	// They default to --version.
+	VersionArgs []string `toml:"version_args"`
+	// StdinFlag is appended to Args when the file is passed on stdin,
+	// for tools like "zig fmt" that read stdin only when asked.
+	StdinFlag string `toml:"stdin_flag"`
+	// Stdout takes only standard output as the command's output, so
+	// that warnings on standard error are not mistaken for contents.
+	// Standard error is returned instead if the command fails.
+	Stdout bool
+	// Env holds variables added to the command's environment.
+	Env map[string]string
+	// Timeout, if set, is how long the command may run before it and
+	// its children are killed.
+	Timeout time.Duration
+}
+
+// run runs c on the file name and returns its combined output, or its
+// standard output if c.Stdout is set. An argument of $name is replaced
+// by name; otherwise stdin is connected to the command.
+func (c *Command) run(name string, stdin io.Reader) ([]byte, error) {
+	return c.runContext(context.Background(), name, name, stdin)
+}
+
+// runPath is like run but replaces $name with path, which may be a
+// temporary copy of name.
+func (c *Command) runPath(name, path string, stdin io.Reader) ([]byte, error) {
+	return c.runContext(context.Background(), name, path, stdin)
+}
+
+// runContext is like runPath but kills the command if ctx is done
+// first.
+func (c *Command) runContext(ctx context.Context, name, path string, stdin io.Reader) ([]byte, error) {
+	dir := filepath.Dir(name)
+	if c.Dir != "" {
+		dir = expandTilde(c.Dir)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(name), dir)
+		}
+	}
+	bin, err := lookCmd(c.Cmd, dir)
+	if err != nil {
+		return nil, &toolError{err}
+	}
+
+	args := replaceArg(c.Args, "$name", path)
+	useStdin := !hasArg(c.Args, "$name")
+	if useStdin && c.StdinFlag != "" {
+		args = append(args[:len(args):len(args)], c.StdinFlag)
+	}
+	release, err := acquireTool(ctx, filepath.Base(c.Cmd))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = dir
+	if len(c.Env) > 0 {
+		cmd.Env = os.Environ()
+		keys := make([]string, 0, len(c.Env))
+		for k := range c.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			cmd.Env = append(cmd.Env, k+"="+c.Env[k])
+		}
+	}
+	if useStdin {
+		cmd.Stdin = stdin
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stdout
+	if c.Stdout {
+		cmd.Stderr = &stderr
+	}
+	setProcessGroup(cmd)
+	if debugFlag {
+		in := ""
+		if useStdin && stdin != nil {
+			in = " < " + name
+		}
+		debugf("%s: run %s%s in %s", name, quoteArgs(append([]string{bin}, args...)), in, dir)
+	}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, &toolError{err}
+	}
+	// Kill the command's whole process group when ctx is done, so
+	// children it started do not outlive it.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd.Process)
+		case <-done:
+		}
+	}()
+	err = cmd.Wait()
+	close(done)
+	debugf("%s: %s finished in %s: %v", name, filepath.Base(bin), time.Since(start).Round(time.Millisecond), errOrOK(err))
+	var ee *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		err = &toolError{fmt.Errorf("timed out after %s", c.Timeout)}
+	case errors.As(err, &ee) && ee.ExitCode() < 0:
+		// Killed by a signal.
+		err = &toolError{err}
+	}
+	if err != nil && c.Stdout {
+		return stderr.Bytes(), err
+	}
+	return stdout.Bytes(), err
+}
+
+// A toolError reports that a command did not run to completion: it was
+// not found or did not start, timed out, or was killed. Unlike a
+// command that exits reporting problems, as linters do, it counts
+// toward the rule's cooldown.
+type toolError struct{ err error }
+
+func (e *toolError) Error() string { return e.err.Error() }
+func (e *toolError) Unwrap() error { return e.err }
+
+// output runs fm on the file name, whose contents are old, and returns
+// the formatted contents. On failure the command's output is returned
+// along with the error.
+func (fm *Formatter) output(name string, old []byte) ([]byte, error) {
+	return fm.outputTimeout(name, old, 0)
+}
+
+// outputTimeout is like output but, if timeout is set, gives fm's
+// command, or builtin, that long to run instead of its own timeout, as
+// a file's overrides may ask.
+func (fm *Formatter) outputTimeout(name string, old []byte, timeout time.Duration) ([]byte, error) {
+	c := fm.Command
+	if timeout > 0 {
+		c.Timeout = timeout
+	}
+	if fm.InPlace && fm.Builtin == "" {
+		return fm.inPlace(&c, name, old)
+	}
+	out := old
+	switch {
+	case fm.Builtin != "":
+		var err error
+		if out, err = fm.builtin(c.Timeout, name, old); err != nil {
+			return out, err
+		}
+	case fm.Cmd != "":
+		var err error
+		if out, err = c.run(name, bytes.NewReader(old)); err != nil {
+			return out, err
+		}
+	}
+	if len(fm.Pipe) > 0 {
+		var err error
+		if out, err = pipe(context.Background(), name, out, fm.Pipe); err != nil {
+			return out, err
+		}
+	}
+	for i := 0; i < fm.StripPrefixLines && len(out) > 0; i++ {
+		j := bytes.IndexByte(out, '\n')
+		if j < 0 {
+			out = out[len(out):]
+			break
+		}
+		out = out[j+1:]
+	}
+	if fm.outputRe != nil {
+		m := fm.outputRe.FindSubmatch(out)
+		if m == nil {
+			return out, errors.New("output does not match output_regex")
+		}
+		out = m[0]
+		if len(m) > 1 {
+			out = m[1]
+		}
+	}
+	if len(out) == 0 && len(old) > 0 && !fm.AllowEmpty {
+		return nil, errors.New("no output for non-empty file; set allow_empty to permit")
+	}
+	return out, nil
+}
+
+// builtin runs fm's builtin on the file name, whose contents are old,
+// stopping it after timeout if set.
+func (fm *Formatter) builtin(timeout time.Duration, name string, old []byte) ([]byte, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	out, err := builtins[fm.Builtin](ctx, fm, name, old)
+	if ctx.Err() == context.DeadlineExceeded {
+		err = &toolError{fmt.Errorf("timed out after %s", timeout)}
+	}
+	return out, err
+}
+
+// inPlace runs c, fm's command, on a temporary copy of name and
+// returns the contents of the copy afterward.
+func (fm *Formatter) inPlace(c *Command, name string, old []byte) ([]byte, error) {
+	tmp, err := tempFile(name, old)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+	if out, err := c.runPath(name, tmp, bytes.NewReader(old)); err != nil {
+		return out, err
+	}
+	out, err := ioutil.ReadFile(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 && len(old) > 0 && !fm.AllowEmpty {
+		return nil, errors.New("empty result for non-empty file; set allow_empty to permit")
+	}
+	return out, nil
+}
+
+// tempFile writes data to a new temporary file standing in for name
+// and returns its path. The file keeps the base name and extension of
+// name so extension-sensitive tools treat it the same. With
+// temp_in_dir it is created, hidden, next to name so tools that
+// discover their config from the file's location find the same one.
+func tempFile(name string, data []byte) (string, error) {
+	dir, pattern := "", "acmewatch-*-"+filepath.Base(name)
+	configMu.RLock()
+	inDir := config.TempInDir
+	configMu.RUnlock()
+	if inDir {
+		dir, pattern = filepath.Dir(name), "."+pattern
+	}
+	f, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// replaceArg returns args with every argument equal to from replaced by
+// to. It returns args itself if there are none.
+func replaceArg(args []string, from, to string) []string {
+	var newArgs []string
+	for i, arg := range args {
+		if arg == from {
+			if newArgs == nil {
+				newArgs = make([]string, len(args))
+				copy(newArgs, args)
+			}
+			newArgs[i] = to
+		}
+	}
+	if newArgs == nil {
+		return args
+	}
+	return newArgs
+}
+
+// hasArg reports whether args contains arg.
+func hasArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// lookCmd resolves cmd to an executable. A leading ~ is expanded to
+// the home directory. A bare name is searched for in $PATH. A relative
+// path is tried in dir and then in the home directory.
+func lookCmd(cmd, dir string) (string, error) {
+	if cmd == "" {
+		return "", fmt.Errorf("no cmd")
+	}
+	cmd = expandTilde(cmd)
+	if !strings.Contains(cmd, "/") {
+		path, err := exec.LookPath(cmd)
+		if err != nil {
+			return "", fmt.Errorf("cmd %q: not found in $PATH", cmd)
+		}
+		return path, nil
+	}
+	if filepath.IsAbs(cmd) {
+		if _, err := os.Stat(cmd); err != nil {
+			return "", fmt.Errorf("cmd %q: not found", cmd)
+		}
+		return cmd, nil
+	}
+	tried := []string{filepath.Join(dir, cmd)}
+	if home, err := os.UserHomeDir(); err == nil {
+		tried = append(tried, filepath.Join(home, cmd))
+	}
+	for _, path := range tried {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("cmd %q: not found (tried %s)", cmd, strings.Join(tried, ", "))
+}
+
+// expandTilde replaces a leading ~ or ~/ in path with the home
+// directory.
+func expandTilde(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// expand expands a leading ~ and environment variables, like $HOME or
+// ${GOPATH}, in c's command and arguments. The placeholders $name and
+// $old are left alone. GOPATH defaults as it does for the go command.
+func (c *Command) expand() {
+	c.Cmd = expandEnv(expandTilde(c.Cmd))
+	for i, a := range c.Args {
+		c.Args[i] = expandEnv(expandTilde(a))
+	}
+}
+
+// expandEnv replaces $NAME and ${NAME} in s, where NAME is a letter or
+// underscore followed by letters, digits and underscores, by the value
+// of the environment variable, and $$ by $. Anything else after a $,
+// like the shell's $1, $@ or $?, is left as is, as are the
+// placeholders $name and $old.
+func expandEnv(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		if s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+		name, end := "", i+1
+		if s[i+1] == '{' {
+			if j := strings.IndexByte(s[i+2:], '}'); j >= 0 && isEnvName(s[i+2:i+2+j]) {
+				name, end = s[i+2:i+2+j], i+3+j
+			}
+		} else {
+			for end < len(s) && (s[end] == '_' || isAlnum(s[end])) {
+				end++
+			}
+			name = s[i+1 : end]
+		}
+		if !isEnvName(name) || name == "name" || name == "old" {
+			b.WriteByte('$')
+			continue
+		}
+		b.WriteString(getenv(name))
+		i = end - 1
+	}
+	return b.String()
+}
+
+// isEnvName reports whether s is a valid environment variable name.
+func isEnvName(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '_' && !isAlnum(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// getenv returns the value of the environment variable k, with GOPATH
+// defaulting as it does for the go command.
+func getenv(k string) string {
+	if k == "GOPATH" && os.Getenv(k) == "" {
+		return build.Default.GOPATH
+	}
+	return os.Getenv(k)
+}
+
+// runChain runs the on_success or on_failure command of ch for the
+// finished rule described by e. The outcome is passed in the
+// environment.
+func runChain(ch Chain, name, rule string, e Event) {
+	argv := ch.OnSuccess
+	if e.Outcome == "failed" {
+		argv = ch.OnFailure
+	}
+	if len(argv) == 0 {
+		return
+	}
+	path, err := lookCmd(argv[0], filepath.Dir(name))
+	if err != nil {
+		emitError(name, err)
+		return
+	}
+	cmd := exec.Command(path, argv[1:]...)
+	cmd.Dir = filepath.Dir(name)
+	cmd.Env = append(os.Environ(),
+		"ACMEWATCH_FILE="+name,
+		"ACMEWATCH_RULE="+rule,
+		"ACMEWATCH_OUTCOME="+e.Outcome,
+		"ACMEWATCH_MESSAGE="+e.Message,
+		"ACMEWATCH_DIAGNOSTICS="+e.Diagnostics,
+	)
+	out, err := cmd.CombinedOutput()
+	ce := Event{Event: "chain", File: name, Rule: rule, Outcome: "ok", Diagnostics: string(out)}
+	if err != nil {
+		ce.Outcome = "failed"
+		ce.Message = argv[0] + ": " + err.Error()
+	}
+	emit(ce)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("ACMEWATCH_TEST", "v")
+	os.Setenv("GOPATH", "/go")
+	for _, tt := range []struct{ in, want string }{
+		{"", ""},
+		{"plain", "plain"},
+		{"$ACMEWATCH_TEST", "v"},
+		{"${ACMEWATCH_TEST}/bin", "v/bin"},
+		{"$ACMEWATCH_TEST/bin", "v/bin"},
+		{"a$ACMEWATCH_TEST.b", "av.b"},
+		{"$GOPATH/bin", "/go/bin"},
+		{"$ACMEWATCH_UNSET", ""},
+		{"$$ACMEWATCH_TEST", "$ACMEWATCH_TEST"},
+		{"$name", "$name"},
+		{"$old", "$old"},
+		{"${name}", "${name}"},
+		{"$1 $@ $? $#", "$1 $@ $? $#"},
+		{"${1}", "${1}"},
+		{"${ACMEWATCH_TEST", "${ACMEWATCH_TEST"},
+		{"cost $", "cost $"},
+	} {
+		if got := expandEnv(tt.in); got != tt.want {
+			t.Errorf("expandEnv(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExpandTilde(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, tt := range []struct{ in, want string }{
+		{"~", home},
+		{"~/bin/tool", filepath.Join(home, "bin/tool")},
+		{"~user/bin", "~user/bin"},
+		{"/bin/~/tool", "/bin/~/tool"},
+		{"tool", "tool"},
+	} {
+		if got := expandTilde(tt.in); got != tt.want {
+			t.Errorf("expandTilde(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
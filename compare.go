@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// compare runs the formatters of cfg that fm compares against on old,
+// the contents of the file name, and reports where their output differs
+// from want, fm's output.
+func compare(cfg *Config, name string, fm *Formatter, old, want []byte) {
+	for _, c := range fm.Compare {
+		other := cfg.formatterNamed(c)
+		if other == nil {
+			continue
+		}
+		start := time.Now()
+		got, err := other.output(name, old)
+		e := Event{
+			Time:     time.Now(),
+			Event:    "compare",
+			File:     name,
+			Rule:     other.Name,
+			Duration: time.Since(start).Seconds(),
+			Outcome:  "ok",
+		}
+		switch {
+		case err != nil:
+			e.Outcome = "failed"
+			e.Message = err.Error()
+			e.Diagnostics = string(got)
+		case !bytes.Equal(got, want):
+			e.Outcome = "failed"
+			e.Message = fmt.Sprintf("output differs from %s", fm.Name)
+			e.Diagnostics = string(renderDiff(want, got, diff(want, got), 1))
+		}
+		emit(e)
+	}
+}
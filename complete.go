@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"9fans.net/go/acme"
+)
+
+// Complete configures the complete command, which completes words from
+// the identifiers in a project's files.
+type Complete struct {
+	// Matcher limits the files indexed. Empty indexes every file.
+	Matcher
+	// Root holds file names, like .git, marking a project's root
+	// directory. Defaults to .git.
+	Root []string
+}
+
+// wordRe matches the identifiers indexed for completion.
+var wordRe = regexp.MustCompile(`[\pL_][\pL\pN_]{2,}`)
+
+// wordIndex holds the identifiers of each file of each indexed project,
+// by project root and file name, and indexing the roots of projects
+// being indexed. They are used only by the main loop.
+var (
+	wordIndex = map[string]map[string][]string{}
+	indexing  = map[string]bool{}
+)
+
+// completeRoot returns the project root of name.
+func completeRoot(name string) string {
+	configMu.RLock()
+	markers := config.Complete.Root
+	configMu.RUnlock()
+	if len(markers) == 0 {
+		markers = []string{".git"}
+	}
+	return projectRoot(filepath.Dir(name), markers)
+}
+
+// indexFile returns the identifiers in the file name, or nil if it is
+// not indexed.
+func indexFile(c *Complete, name string) []string {
+	if !c.selects(name) {
+		return nil
+	}
+	info, err := os.Stat(name)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxTodoFile {
+		return nil
+	}
+	src, err := ioutil.ReadFile(name)
+	if err != nil || isBinary(src) {
+		return nil
+	}
+	seen := map[string]bool{}
+	var words []string
+	for _, w := range wordRe.FindAll(src, -1) {
+		if !seen[string(w)] {
+			seen[string(w)] = true
+			words = append(words, string(w))
+		}
+	}
+	return words
+}
+
+// projectWords returns the index of the project at root. On first use
+// the index is built in the background, since reading every file of a
+// large project takes a while; until it is done, projectWords returns
+// what is indexed so far, like files saved meanwhile, and reports that
+// the index is incomplete.
+func projectWords(root string) (map[string][]string, bool) {
+	if idx := wordIndex[root]; idx != nil {
+		return idx, !indexing[root]
+	}
+	configMu.RLock()
+	c := config.Complete
+	configMu.RUnlock()
+	wordIndex[root] = map[string][]string{}
+	indexing[root] = true
+	go func() {
+		built := map[string][]string{}
+		files, err := trackedFiles(root)
+		if err != nil {
+			log.Print(err)
+		}
+		for _, f := range files {
+			if words := indexFile(&c, f); words != nil {
+				built[f] = words
+			}
+		}
+		mainFuncs <- func() {
+			delete(indexing, root)
+			idx := wordIndex[root]
+			for f, words := range built {
+				// Files saved meanwhile are already up to date.
+				if _, ok := idx[f]; !ok {
+					idx[f] = words
+				}
+			}
+		}
+	}()
+	return wordIndex[root], false
+}
+
+// completeSaved reindexes the saved file name if its project is
+// indexed.
+func completeSaved(name string) {
+	idx := wordIndex[completeRoot(name)]
+	if idx == nil {
+		return
+	}
+	configMu.RLock()
+	c := config.Complete
+	configMu.RUnlock()
+	if words := indexFile(&c, name); words != nil {
+		idx[name] = words
+	} else {
+		delete(idx, name)
+	}
+}
+
+// completeWord is the complete control command. It completes the word
+// ending at dot in window id, given as its argument, with identifiers
+// from the window's project: the longest prefix the candidates share is
+// inserted, and the candidates are listed if there are several.
+func completeWord(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: complete winid")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "", fmt.Errorf("bad window id %q", args[0])
+	}
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return "", err
+	}
+	defer w.CloseFiles()
+	tag, err := w.ReadAll("tag")
+	if err != nil {
+		return "", err
+	}
+	f := strings.Fields(string(tag))
+	if len(f) == 0 {
+		return "", errors.New("window has no name")
+	}
+	name := f[0]
+	if err := w.Ctl("addr=dot"); err != nil {
+		return "", err
+	}
+	_, q1, err := w.ReadAddr()
+	if err != nil {
+		return "", err
+	}
+	body, err := w.ReadAll("body")
+	if err != nil {
+		return "", err
+	}
+	prefix := wordBefore(body, q1)
+	if prefix == "" {
+		return "", errors.New("no word at dot")
+	}
+	seen := map[string]bool{}
+	var cands []string
+	add := func(word string) {
+		if len(word) > len(prefix) && strings.HasPrefix(word, prefix) && !seen[word] {
+			seen[word] = true
+			cands = append(cands, word)
+		}
+	}
+	// The window's own words are candidates while the project is
+	// being indexed, and since its last put.
+	for _, word := range wordRe.FindAll(body, -1) {
+		add(string(word))
+	}
+	idx, complete := projectWords(completeRoot(name))
+	for _, words := range idx {
+		for _, word := range words {
+			add(word)
+		}
+	}
+	if len(cands) == 0 {
+		if !complete {
+			return "", fmt.Errorf("no completions for %s yet; indexing the project", prefix)
+		}
+		return "", fmt.Errorf("no completions for %s", prefix)
+	}
+	sort.Strings(cands)
+	common := cands[0]
+	for _, c := range cands[1:] {
+		for !strings.HasPrefix(c, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	if len(common) > len(prefix) {
+		if err := w.Addr("#%d", q1); err != nil {
+			return "", err
+		}
+		w.Write("data", []byte(common[len(prefix):]))
+		q := q1 + utf8.RuneCountInString(common[len(prefix):])
+		w.Addr("#%d", q)
+		w.Ctl("dot=addr")
+	}
+	if len(cands) == 1 {
+		return "ok", nil
+	}
+	return strings.Join(cands, "\n"), nil
+}
+
+// wordBefore returns the identifier characters immediately before rune
+// offset q in body.
+func wordBefore(body []byte, q int) string {
+	r := []rune(string(body))
+	if q > len(r) {
+		q = len(r)
+	}
+	i := q
+	for i > 0 && (unicode.IsLetter(r[i-1]) || unicode.IsDigit(r[i-1]) || r[i-1] == '_') {
+		i--
+	}
+	return string(r[i:q])
+}
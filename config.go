@@ -0,0 +1,865 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+	toml "github.com/pelletier/go-toml"
+)
+
+type Config struct {
+	// Include lists config files, relative to this one and possibly
+	// globs, merged into it. Their rules follow this file's.
+	Include   []string
+	Formatter []*Formatter
+	Hook      []*Hook
+	// Rename holds hooks run when a window is put under a new name.
+	// An argument "$old" is replaced by the previous name.
+	Rename []*Hook
+	Idle   []*Idle
+	Filter []*Filter
+	Warm   []*Warm
+	Burst  Burst
+	// TempInDir creates temporary copies of files in the file's
+	// directory instead of the system temporary directory.
+	TempInDir bool `toml:"temp_in_dir"`
+	// Address is the style diagnostic addresses are rewritten to:
+	// "line", "col", or "offset". Empty leaves them as printed.
+	Address string
+	// PreviewContext is the number of unchanged lines shown around
+	// each change in preview windows. Longer runs are folded.
+	PreviewContext int `toml:"preview_context"`
+	// DiffCmd lists the diff commands tried in order, like "9 diff"
+	// or "diff", until one runs. "internal" names the built-in diff,
+	// which is also the last resort and the default.
+	DiffCmd  []string `toml:"diff_cmd"`
+	Severity Severity
+	Queue    Queue
+	// Observe runs every rule but leaves windows and files alone,
+	// reporting what formatters would change, to trial a config.
+	Observe bool
+	// Undo controls how reformatting appears in the window's undo
+	// history: "mark" (the default) as one step, "nomark" merged into
+	// the user's last change, or "hunk" as one step per change.
+	Undo string
+	// Serve holds the rules of the live preview server, which listens
+	// on ServeAddr.
+	Serve     []*ServeRule
+	ServeAddr string `toml:"serve_addr"`
+	Cooldown  Cooldown
+	Strict    Strict
+	// History is the number of applied formatting changes kept per
+	// window for the showlast command.
+	History int
+	// SameName is the policy for other windows with the same name as
+	// a formatted one: "window" (the default) leaves them alone, and
+	// "all" applies the changes to those showing what was formatted.
+	SameName string `toml:"same_name"`
+	// Formatters is "first" (the default) to run only the first
+	// formatter matching a file or "all" to run every one in order.
+	Formatters string
+	// Scope holds directories outside which events are ignored. Empty
+	// allows all. Once checked, they are absolute.
+	Scope []string
+	// Exclude holds globs of files never formatted, even by a matching
+	// formatter.
+	Exclude []string
+	Todo    Todo
+	// Autoput writes a window back to disk after formatting is applied
+	// to it, so the file is formatted without a second Put.
+	Autoput   bool
+	Outline   []*Outline
+	Complete  Complete
+	Clipboard Clipboard
+	// Debounce holds a put until no other put of the window follows
+	// it for this long, so rapid puts run the rules once.
+	Debounce time.Duration
+	// Parallel caps, by command name, how many runs of a tool may run
+	// at once. Others wait their turn in order.
+	Parallel map[string]int
+	// Errors is where diagnostics go: "dir" (the default) for the
+	// +Errors window of the file's directory, "global" for a single
+	// +Errors window, or "stdout" to print them.
+	Errors string
+	// Commands are hooks whose output is shown in acme, in the +Errors
+	// window of the file's directory. They are moved to Hook once the
+	// config is read.
+	Commands []*Hook `toml:"command"`
+}
+
+// Burst configures detection of rapid event sequences on one window,
+// as produced by Edit commands or scripts driving acme. A put during
+// a burst is deferred until the window has been quiet for Quiet.
+type Burst struct {
+	// Events is the number of events within Within that makes a
+	// burst. Negative disables burst detection.
+	Events int
+	Within time.Duration
+	Quiet  time.Duration
+}
+
+type Formatter struct {
+	Name string
+	Matcher
+	Command
+	// After names formatters or hooks that must finish before this
+	// one starts.
+	After []string
+	Chain
+	// SkipUnchanged skips the rule when the formatters it comes after
+	// left the file unchanged.
+	SkipUnchanged bool `toml:"skip_unchanged"`
+	// Trigger is "put" (the default) to run on every put, or "changed"
+	// to run only when the put saved different contents than the
+	// window's previous put.
+	Trigger string
+	// Origin limits the rule to puts of the listed origins:
+	// "interactive" or "script". Empty allows all.
+	Origin []string
+	// AllowEmpty permits empty output for a non-empty file. Otherwise
+	// it is treated as an error instead of deleting the whole body.
+	AllowEmpty bool `toml:"allow_empty"`
+	// StripPrefixLines drops that many leading lines, such as a
+	// banner, from the output.
+	StripPrefixLines int `toml:"strip_prefix_lines"`
+	// OutputRegex, if set, extracts the file contents from the output:
+	// its first submatch, or the whole match if it has no groups.
+	OutputRegex string `toml:"output_regex"`
+	// Compare names other formatters to also run on the file. Their
+	// output is only compared to this one's, and differences reported.
+	Compare []string
+	// Mode is "apply" (the default) to apply the output to the window,
+	// "preview" to show the changes in a preview window instead,
+	// "check" to only report the lines that would change, or "edit" to
+	// write them as Edit commands into a window.
+	Mode string
+	// InPlace runs the command on a temporary copy of the file, passed
+	// as $name, and uses the copy's contents afterward instead of the
+	// command's output.
+	InPlace bool `toml:"in_place"`
+	// Then is "stop" to make this the last formatter run on a file,
+	// or "continue" to also run later matching ones. It defaults to
+	// the formatters policy.
+	Then string
+	// Autoput, if set, overrides the top-level autoput for this
+	// formatter.
+	Autoput *bool
+	// DryRun reports the changes the formatter would make, as a
+	// diff, instead of making them.
+	DryRun bool `toml:"dry_run"`
+	// Pipe holds commands run in turn after Cmd, if any, each given
+	// the previous one's output.
+	Pipe []Command
+	// Builtin names a formatter built into acmewatch to run instead of
+	// Cmd: "bazel", "cue", "dhall", "include_guard", "jsonnet",
+	// "latex", "python", "rust", or "shell".
+	Builtin string
+	Guard   Guard
+
+	outputRe *regexp.Regexp
+}
+
+// Hook is a command run on put whose output is printed instead of
+// applied to the window.
+type Hook struct {
+	Name string
+	Matcher
+	Command
+	After         []string
+	SkipUnchanged bool `toml:"skip_unchanged"`
+	Trigger       string
+	Origin        []string
+	// Cost is the expected duration of the hook, used to schedule it.
+	// It defaults to the hook's mean duration so far.
+	Cost time.Duration
+	Chain
+	// Builtin names a hook built into acmewatch to run instead of
+	// Cmd: "buildozer", "clippy", "ctags", "latexmk", "line_length",
+	// "render", or "shellcheck".
+	Builtin string
+	// Plumb plumbs what a builtin hook builds, such as a PDF, once
+	// built.
+	Plumb      bool
+	Render     Render
+	LineLength LineLength `toml:"line_length"`
+	Tags       Tags
+	// toErrors shows the hook's output in the +Errors window of the
+	// file's directory, as for command tables.
+	toErrors bool
+}
+
+// command returns the name of the command h runs.
+func (h *Hook) command() string {
+	if h.Builtin != "" {
+		return h.Builtin
+	}
+	return h.Cmd
+}
+
+// Queue configures how hooks are scheduled. Hooks run in the
+// background, at most Jobs at a time, cheapest first, except that a
+// hook waiting longer than MaxWait goes ahead of the rest.
+type Queue struct {
+	Jobs    int
+	MaxWait time.Duration `toml:"max_wait"`
+}
+
+// Chain holds commands, as argument lists, run after a rule finishes.
+type Chain struct {
+	OnSuccess []string `toml:"on_success"`
+	OnFailure []string `toml:"on_failure"`
+}
+
+// Warm is a command run once per project when a matching window is
+// focused, to start or prime project-scoped tools before the first
+// save.
+type Warm struct {
+	Name string
+	Matcher
+	Command
+	// Root lists files that mark a project's root directory, like
+	// go.mod. The command runs there unless Dir is set.
+	Root []string
+}
+
+// Idle is a command run once a matching window has seen no changes
+// for Delay. The window body is passed as stdin.
+type Idle struct {
+	Name string
+	Matcher
+	Command
+	Delay time.Duration
+}
+
+// ruleNames returns the names of every configured rule, including
+// those of project configs read so far.
+func ruleNames() []string {
+	names := config.ruleNames()
+	seen := map[string]bool{}
+	for _, n := range names {
+		seen[n] = true
+	}
+	for _, n := range projectRuleNames() {
+		if !seen[n] {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// ruleNames returns the names of c's rules.
+func (c *Config) ruleNames() []string {
+	var names []string
+	for _, fm := range c.Formatter {
+		names = append(names, fm.Name)
+	}
+	for _, h := range c.Hook {
+		names = append(names, h.Name)
+	}
+	for _, h := range c.Rename {
+		names = append(names, h.Name)
+	}
+	for _, r := range c.Idle {
+		names = append(names, r.Name)
+	}
+	for _, r := range c.Warm {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// nameRules checks that rule names are unique and names unnamed rules
+// after their command, adding a number if the command's name is taken.
+func (c *Config) nameRules() error {
+	for _, h := range c.Commands {
+		h.toErrors = true
+	}
+	c.Hook = append(c.Hook, c.Commands...)
+	c.Commands = nil
+	var names []*string
+	var cmds []string
+	for _, fm := range c.Formatter {
+		cmd := fm.Cmd
+		if fm.Builtin != "" {
+			cmd = fm.Builtin
+		} else if cmd == "" && len(fm.Pipe) > 0 {
+			cmd = fm.Pipe[0].Cmd
+		}
+		names, cmds = append(names, &fm.Name), append(cmds, cmd)
+	}
+	for _, h := range c.Hook {
+		names, cmds = append(names, &h.Name), append(cmds, h.command())
+	}
+	for _, h := range c.Rename {
+		names, cmds = append(names, &h.Name), append(cmds, h.command())
+	}
+	for _, r := range c.Idle {
+		names, cmds = append(names, &r.Name), append(cmds, r.Cmd)
+	}
+	for _, r := range c.Warm {
+		names, cmds = append(names, &r.Name), append(cmds, r.Cmd)
+	}
+	taken := map[string]bool{}
+	for _, n := range names {
+		if *n == "" {
+			continue
+		}
+		if taken[*n] {
+			return fmt.Errorf("duplicate rule name %q", *n)
+		}
+		taken[*n] = true
+	}
+	for i, n := range names {
+		if *n != "" {
+			continue
+		}
+		base := filepath.Base(cmds[i])
+		*n = base
+		for j := 2; taken[*n]; j++ {
+			*n = fmt.Sprintf("%s#%d", base, j)
+		}
+		taken[*n] = true
+	}
+	return nil
+}
+
+// findConfig returns the path of the config file: the -config flag,
+// else $ACMEWATCH_CONFIG, else acmewatch.toml in the XDG config
+// directory.
+func findConfig() (string, error) {
+	path := *configFlag
+	if path == "" {
+		path = os.Getenv("ACMEWATCH_CONFIG")
+	}
+	if path == "" {
+		return xdg.ConfigFile("acmewatch.toml")
+	}
+	customConfig = true
+	return filepath.Abs(expandTilde(path))
+}
+
+var (
+	// badMod is the modification time of the config file when it last
+	// failed to decode, and badErr the error.
+	badMod time.Time
+	badErr error
+	// forceReload makes the next readConfig reread the config file
+	// even if it is unmodified.
+	forceReload bool
+	// configWatched is set while the config file is watched for
+	// changes, which set configDirty. readConfig then checks the file
+	// only once it is dirty, instead of on every event.
+	configWatched, configDirty bool
+	// configFiles are the files last read for the config: the config
+	// file, those it includes and its fragments.
+	configFiles []string
+)
+
+// readConfig rereads the config file if it has been modified since
+// the last read. If it no longer decodes, the error is reported once
+// and the previous config is kept; with none to keep, the error is
+// returned.
+func readConfig() error {
+	if configWatched && !configDirty && !forceReload {
+		if lastMod.IsZero() && badErr != nil {
+			return badErr
+		}
+		return nil
+	}
+	configDirty = false
+	mod, err := configMod()
+	if err != nil {
+		return err
+	}
+	if !forceReload && (!mod.After(lastMod) || mod.Equal(badMod)) {
+		if lastMod.IsZero() && badErr != nil {
+			return badErr
+		}
+		return nil
+	}
+	forceReload = false
+	tree, files, err := loadConfigTree(configPath)
+	if len(files) > 0 {
+		configFiles = files
+		if configWatched {
+			if err := watchFiles(configFiles); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+	var c *Config
+	if err == nil {
+		c, err = decodeConfig(tree)
+	}
+	if err != nil {
+		badMod, badErr = mod, fmt.Errorf("%s: %v", configPath, err)
+		if lastMod.IsZero() {
+			return badErr
+		}
+		emit(Event{Event: "config", File: configPath, Outcome: "failed", Message: err.Error() + "; keeping the previous config"})
+		return nil
+	}
+	configMu.Lock()
+	config, lastMod = c, mod
+	configMu.Unlock()
+	badErr = nil
+	noteRules(config.ruleNames())
+	emit(Event{Event: "config", File: configPath, Outcome: "ok", Message: fmt.Sprintf("read at %s", lastMod)})
+	startServer()
+	return nil
+}
+
+// currentConfig returns the config in effect, for goroutines other
+// than the main loop. It must not be modified.
+func currentConfig() *Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config
+}
+
+// configMod returns the latest modification time of the config file,
+// its fragment directory and the files last read with it.
+func configMod() (time.Time, error) {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	mod := info.ModTime()
+	for _, p := range append([]string{fragmentDir(configPath)}, configFiles...) {
+		if info, err := os.Stat(p); err == nil && info.ModTime().After(mod) {
+			mod = info.ModTime()
+		}
+	}
+	return mod, nil
+}
+
+// decodeConfig returns the config decoded from tree, checked and with
+// defaults filled in.
+func decodeConfig(tree *toml.Tree) (*Config, error) {
+	c := new(Config)
+	if err := tree.Unmarshal(c); err != nil {
+		return nil, err
+	}
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reloadConfig rereads the config and project config files whether or
+// not they were modified, as on SIGHUP.
+func reloadConfig() {
+	forceReload = true
+	projectsMu.Lock()
+	projects = map[string]*project{}
+	projectsMu.Unlock()
+	if err := readConfig(); err != nil {
+		emitError(configPath, err)
+	}
+}
+
+// check checks c and fills in defaults.
+func (c *Config) check() error {
+	if err := c.checkRules(); err != nil {
+		return err
+	}
+	return c.checkCompare()
+}
+
+// checkCompare checks that the formatters compared against exist.
+func (c *Config) checkCompare() error {
+	for _, fm := range c.Formatter {
+		for _, name := range fm.Compare {
+			if c.formatterNamed(name) == nil {
+				return fmt.Errorf("%s: compare: no formatter named %q", fm.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkRules is check without checkCompare, so that a project config
+// can be checked before the global rules it compares against are
+// merged in.
+func (c *Config) checkRules() error {
+	switch c.Undo {
+	case "", "mark", "nomark", "hunk":
+	default:
+		return fmt.Errorf("unknown undo style %q", c.Undo)
+	}
+	if c.Strict.Banner != "" && strings.Count(c.Strict.Banner, "%s") != 1 {
+		return fmt.Errorf("strict banner must contain %%s once")
+	}
+	switch c.SameName {
+	case "", "window", "all":
+	default:
+		return fmt.Errorf("unknown same_name policy %q", c.SameName)
+	}
+	switch c.Errors {
+	case "", "dir", "global", "stdout":
+	default:
+		return fmt.Errorf("unknown errors policy %q", c.Errors)
+	}
+	switch c.Formatters {
+	case "", "first", "all":
+	default:
+		return fmt.Errorf("unknown formatters policy %q", c.Formatters)
+	}
+	switch c.Address {
+	case "", "line", "col", "offset":
+	default:
+		return fmt.Errorf("unknown address style %q", c.Address)
+	}
+	if err := c.nameRules(); err != nil {
+		return err
+	}
+	for _, fm := range c.Formatter {
+		if err := checkTrigger(fm.Name, fm.Trigger); err != nil {
+			return err
+		}
+		if err := checkOrigin(fm.Name, fm.Origin); err != nil {
+			return err
+		}
+		switch fm.Mode {
+		case "", "apply", "preview", "check", "edit":
+		default:
+			return fmt.Errorf("%s: unknown mode %q", fm.Name, fm.Mode)
+		}
+		switch fm.Then {
+		case "", "stop", "continue":
+		default:
+			return fmt.Errorf("%s: unknown then %q", fm.Name, fm.Then)
+		}
+		if fm.Builtin != "" && builtins[fm.Builtin] == nil {
+			return fmt.Errorf("%s: unknown builtin %q", fm.Name, fm.Builtin)
+		}
+		switch fm.Guard.Style {
+		case "", "ifndef", "pragma":
+		default:
+			return fmt.Errorf("%s: unknown guard style %q", fm.Name, fm.Guard.Style)
+		}
+	}
+	if c.PreviewContext <= 0 {
+		c.PreviewContext = 3
+	}
+	for _, h := range append(c.Hook, c.Rename...) {
+		if h.Builtin != "" && hookBuiltins[h.Builtin] == nil {
+			return fmt.Errorf("%s: unknown builtin %q", h.Name, h.Builtin)
+		}
+		if h.Builtin == "line_length" {
+			if h.LineLength.Width <= 0 {
+				return fmt.Errorf("%s: line_length: no width", h.Name)
+			}
+			if h.LineLength.TabWidth <= 0 {
+				h.LineLength.TabWidth = 8
+			}
+		}
+		switch h.Render.Format {
+		case "", "svg", "png":
+		default:
+			return fmt.Errorf("%s: unknown render format %q", h.Name, h.Render.Format)
+		}
+	}
+	for _, h := range c.Hook {
+		switch h.Trigger {
+		case "new", "del":
+			// Only hooks run when a window opens or closes.
+		default:
+			if err := checkTrigger(h.Name, h.Trigger); err != nil {
+				return err
+			}
+		}
+		if err := checkOrigin(h.Name, h.Origin); err != nil {
+			return err
+		}
+	}
+	for _, fm := range c.Formatter {
+		fm.expand()
+		for i := range fm.Pipe {
+			fm.Pipe[i].expand()
+		}
+	}
+	for _, h := range append(c.Hook, c.Rename...) {
+		h.expand()
+	}
+	for _, r := range c.Idle {
+		r.expand()
+	}
+	for _, r := range c.Warm {
+		r.expand()
+	}
+	for _, r := range c.Serve {
+		r.expand()
+	}
+	for _, f := range c.Filter {
+		if err := f.setEncrypt(); err != nil {
+			return err
+		}
+		if err := f.setMinified(); err != nil {
+			return err
+		}
+		f.Get.expand()
+		f.Put.expand()
+		if err := f.compileMatch(); err != nil {
+			return err
+		}
+	}
+	for _, fm := range c.Formatter {
+		if err := fm.compileMatch(); err != nil {
+			return err
+		}
+		if fm.OutputRegex != "" && fm.outputRe == nil {
+			var err error
+			if fm.outputRe, err = regexp.Compile(fm.OutputRegex); err != nil {
+				return fmt.Errorf("%s: output_regex: %s", fm.Name, err)
+			}
+		}
+	}
+	for _, h := range c.Hook {
+		if err := h.compileMatch(); err != nil {
+			return err
+		}
+	}
+	for _, h := range c.Rename {
+		if err := h.compileMatch(); err != nil {
+			return err
+		}
+	}
+	for _, r := range c.Warm {
+		if err := r.compileMatch(); err != nil {
+			return err
+		}
+	}
+	for _, r := range c.Serve {
+		if err := r.compileMatch(); err != nil {
+			return err
+		}
+	}
+	if err := c.Todo.check(); err != nil {
+		return err
+	}
+	if err := c.Complete.compileMatch(); err != nil {
+		return err
+	}
+	if err := c.Clipboard.check(); err != nil {
+		return err
+	}
+	for _, o := range c.Outline {
+		if err := o.check(); err != nil {
+			return err
+		}
+	}
+	for i, d := range c.Scope {
+		abs, err := filepath.Abs(expandTilde(d))
+		if err != nil {
+			return fmt.Errorf("scope %q: %v", d, err)
+		}
+		c.Scope[i] = abs
+	}
+	fixMatch(c.Exclude)
+	if err := checkExclude(c.Exclude); err != nil {
+		return err
+	}
+	if c.ServeAddr == "" {
+		c.ServeAddr = "localhost:7070"
+	}
+	for _, id := range c.Idle {
+		if err := id.compileMatch(); err != nil {
+			return err
+		}
+		if id.Delay <= 0 {
+			id.Delay = 2 * time.Second
+		}
+	}
+	if c.Burst.Events == 0 {
+		c.Burst.Events = 4
+	}
+	if c.Burst.Within <= 0 {
+		c.Burst.Within = time.Second
+	}
+	if c.Burst.Quiet <= 0 {
+		c.Burst.Quiet = time.Second
+	}
+	if c.Cooldown.Duration <= 0 {
+		c.Cooldown.Duration = 10 * time.Minute
+	}
+	if c.History <= 0 {
+		c.History = 10
+	}
+	if c.Queue.Jobs <= 0 {
+		c.Queue.Jobs = 2
+	}
+	if c.Queue.MaxWait <= 0 {
+		c.Queue.MaxWait = 30 * time.Second
+	}
+	return nil
+}
+
+func checkOrigin(rule string, origins []string) error {
+	for _, o := range origins {
+		if o != "interactive" && o != "script" {
+			return fmt.Errorf("%s: unknown origin %q", rule, o)
+		}
+	}
+	return nil
+}
+
+// originOK reports whether a rule limited to origins runs for a put of
+// origin.
+func originOK(origins []string, origin string) bool {
+	if len(origins) == 0 {
+		return true
+	}
+	for _, o := range origins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTrigger(rule, trigger string) error {
+	switch trigger {
+	case "", "put", "changed":
+		return nil
+	}
+	return fmt.Errorf("%s: unknown trigger %q", rule, trigger)
+}
+
+// A Matcher selects the files a rule applies to: those matching any of
+// the globs in Match, the regular expression MatchRe, or the file's
+// shebang or modeline.
+type Matcher struct {
+	Match []string
+	// MatchRe is matched against the full path of the file.
+	MatchRe string `toml:"match_re"`
+	// Shebang holds globs matched against the program run by a file's
+	// #! line, like "python*" for "#!/usr/bin/env python3".
+	Shebang []string
+	// Modeline holds globs matched against the file type set by a vim
+	// or emacs modeline, like "python".
+	Modeline []string
+	// Exclude holds globs of files not matched even if they match
+	// Match or MatchRe.
+	Exclude []string
+	re      *regexp.Regexp
+}
+
+// compileMatch fixes m's globs and compiles MatchRe.
+func (m *Matcher) compileMatch() error {
+	fixMatch(m.Match)
+	fixMatch(m.Exclude)
+	if err := checkExclude(m.Exclude); err != nil {
+		return err
+	}
+	if m.MatchRe == "" || m.re != nil {
+		return nil
+	}
+	re, err := regexp.Compile(m.MatchRe)
+	if err != nil {
+		return fmt.Errorf("match_re %q: %s", m.MatchRe, err)
+	}
+	m.re = re
+	return nil
+}
+
+// selects is like matches but, for settings that limit the files they
+// scan, selects every file not excluded if m has no match patterns.
+func (m *Matcher) selects(name string) bool {
+	if len(m.Match) == 0 && m.MatchRe == "" && len(m.Shebang) == 0 && len(m.Modeline) == 0 {
+		return !excluded(m.Exclude, name)
+	}
+	matched, _ := m.matches(name)
+	return matched
+}
+
+// matches reports whether name is selected by m.
+func (m *Matcher) matches(name string) (bool, error) {
+	if excluded(m.Exclude, name) {
+		return false, nil
+	}
+	if m.re != nil && m.re.MatchString(name) {
+		return true, nil
+	}
+	matched, err := match(m.Match, name)
+	if matched || err != nil {
+		return matched, err
+	}
+	return m.matchContent(name), nil
+}
+
+// excluded reports whether name matches any of the exclude globs in
+// patterns. A relative glob matches the trailing elements of the path,
+// so one without a slash matches the base name, and a glob ending in
+// /** matches every file under a directory it matches, at any depth.
+func excluded(patterns []string, name string) bool {
+	parts := strings.Split(filepath.ToSlash(name), "/")
+	for _, p := range patterns {
+		dir := strings.TrimSuffix(p, "/**")
+		n := strings.Count(dir, "/") + 1
+		if dir == p {
+			// Only the trailing n elements can match a file glob.
+			if n <= len(parts) {
+				if ok, _ := path.Match(p, strings.Join(parts[len(parts)-n:], "/")); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for i := 0; i+n < len(parts); i++ {
+			if path.IsAbs(dir) && i > 0 {
+				break
+			}
+			if ok, _ := path.Match(dir, strings.Join(parts[i:i+n], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkExclude reports a malformed glob in patterns.
+func checkExclude(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(strings.TrimSuffix(p, "/**"), ""); err != nil {
+			return fmt.Errorf("exclude %q: %s", p, err)
+		}
+	}
+	return nil
+}
+
+// fixMatch rewrites bare extensions like ".go" to "*.go".
+func fixMatch(match []string) {
+	for i, m := range match {
+		if strings.HasPrefix(m, ".") && !strings.Contains(m, "*") {
+			match[i] = "*" + m
+		}
+	}
+}
+
+// match reports whether name matches any of the globs in patterns.
+// Patterns beginning with "*." match against the base name.
+func match(patterns []string, name string) (bool, error) {
+	for _, m := range patterns {
+		matchName := name
+		if strings.HasPrefix(m, "*.") {
+			matchName = filepath.Base(matchName)
+		}
+		matched, err := filepath.Match(m, matchName)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
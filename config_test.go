@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestExcluded(t *testing.T) {
+	for _, tt := range []struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		{nil, "/src/a.go", false},
+		{[]string{"*.pb.go"}, "/src/a.pb.go", true},
+		{[]string{"*.pb.go"}, "/src/a.go", false},
+		{[]string{"gen/*.go"}, "/src/gen/a.go", true},
+		{[]string{"gen/*.go"}, "/src/gen/sub/a.go", false},
+		{[]string{"vendor/**"}, "/src/vendor/x/y/a.go", true},
+		{[]string{"vendor/**"}, "/src/vendor", false},
+		{[]string{"vendor/**"}, "/src/notvendor/a.go", false},
+		{[]string{"/src/vendor/**"}, "/src/vendor/a.go", true},
+		{[]string{"/src/vendor/**"}, "/other/src/vendor/a.go", false},
+		{[]string{"a.go", "[bad"}, "/src/a.go", true},
+	} {
+		if got := excluded(tt.patterns, tt.name); got != tt.want {
+			t.Errorf("excluded(%q, %q) = %v, want %v", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		patterns []string
+		name     string
+		want     bool
+		err      bool
+	}{
+		{nil, "/src/a.go", false, false},
+		{[]string{"*.go"}, "/src/a.go", true, false},
+		{[]string{"*.go"}, "/src/a.go.orig", false, false},
+		{[]string{"*.c", "*.h"}, "/src/a.h", true, false},
+		{[]string{"/src/*"}, "/src/a.go", true, false},
+		{[]string{"/src/*"}, "/src/sub/a.go", false, false},
+		{[]string{"Makefile"}, "/src/Makefile", false, false},
+		{[]string{"[bad"}, "/src/a.go", false, true},
+	} {
+		got, err := match(tt.patterns, tt.name)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("match(%q, %q) = %v, %v; want %v, error %v", tt.patterns, tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	toml "github.com/pelletier/go-toml"
+)
+
+// checkConfigs checks each config file in paths, printing the problems
+// found, and reports whether there were none.
+func checkConfigs(paths []string) bool {
+	ok := true
+	for _, p := range paths {
+		problems := checkConfigFile(p)
+		for _, msg := range problems {
+			fmt.Printf("%s:%s\n", p, msg)
+		}
+		if len(problems) > 0 {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkConfigFile returns the problems of the config file at p: keys
+// no setting uses, errors in its settings, globs that cannot match, and
+// commands that cannot be found. Each starts with a line number, if it
+// has one.
+func checkConfigFile(p string) []string {
+	tree, files, err := loadConfigTree(p)
+	if err != nil {
+		return []string{" " + err.Error()}
+	}
+	// Unknown keys are reported per file, so they can be found.
+	var problems []string
+	for i, f := range files {
+		t, err := toml.LoadFile(f)
+		if err != nil {
+			return append(problems, " "+err.Error())
+		}
+		for _, k := range unknownKeys(t, reflect.TypeOf(Config{}), "") {
+			if i > 0 {
+				k = " " + f + ":" + k
+			}
+			problems = append(problems, k)
+		}
+	}
+	var c Config
+	if err := tree.Unmarshal(&c); err != nil {
+		return append(problems, " "+err.Error())
+	}
+	if err := c.check(); err != nil {
+		return append(problems, " "+err.Error())
+	}
+	home, _ := os.UserHomeDir()
+	walkRules(reflect.ValueOf(&c).Elem(), "", func(rule string, v interface{}) {
+		prefix := " "
+		if rule != "" {
+			prefix = " " + rule + ": "
+		}
+		switch v := v.(type) {
+		case *Matcher:
+			for _, globs := range [][]string{v.Match, v.Shebang, v.Modeline} {
+				for _, g := range globs {
+					if _, err := path.Match(g, ""); err != nil {
+						problems = append(problems, fmt.Sprintf("%sglob %q: %v", prefix, g, err))
+					}
+				}
+			}
+		case *Command:
+			if v.Cmd == "" {
+				return
+			}
+			if _, err := lookCmd(v.Cmd, home); err != nil {
+				problems = append(problems, prefix+err.Error())
+			}
+		}
+	})
+	return problems
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// unknownKeys returns the keys of tree, at the key path prefix, that
+// decoding into a value of type t ignores, as go-toml does not report
+// them.
+func unknownKeys(tree *toml.Tree, t reflect.Type, prefix string) []string {
+	var problems []string
+	for _, k := range tree.Keys() {
+		full := k
+		if prefix != "" {
+			full = prefix + "." + k
+		}
+		f, ok := tomlField(t, k)
+		if !ok {
+			pos := tree.GetPosition(k)
+			problems = append(problems, fmt.Sprintf("%d:%d: unknown key %s", pos.Line, pos.Col, full))
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct || ft == timeType || ft == durationType {
+			continue
+		}
+		switch v := tree.Get(k).(type) {
+		case *toml.Tree:
+			problems = append(problems, unknownKeys(v, ft, full)...)
+		case []*toml.Tree:
+			for _, sub := range v {
+				problems = append(problems, unknownKeys(sub, ft, full)...)
+			}
+		}
+	}
+	return problems
+}
+
+// tomlField returns the field of the struct type t, or of a struct it
+// embeds, that go-toml decodes key into.
+func tomlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		tag := f.Tag.Get("toml")
+		if tag == "-" {
+			continue
+		}
+		if tag != "" {
+			name = strings.Split(tag, ",")[0]
+		}
+		// go-toml tries these spellings of the name in turn.
+		for _, n := range []string{name, strings.ToLower(name), strings.ToTitle(name), strings.ToLower(name[:1]) + name[1:]} {
+			if key == n {
+				return f, true
+			}
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if sub, ok := tomlField(f.Type, key); ok {
+				return sub, true
+			}
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// walkRules calls fn with every Matcher and Command in v, along with
+// the name of the rule holding them, if it has one.
+func walkRules(v reflect.Value, rule string, fn func(rule string, v interface{})) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			walkRules(v.Elem(), rule, fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkRules(v.Index(i), rule, fn)
+		}
+	case reflect.Struct:
+		switch p := v.Addr().Interface().(type) {
+		case *Matcher, *Command:
+			fn(rule, p)
+		}
+		if n := v.FieldByName("Name"); n.IsValid() && n.Kind() == reflect.String && n.String() != "" {
+			rule = n.String()
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				walkRules(v.Field(i), rule, fn)
+			}
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import "context"
+
+// Formatters for configuration languages, each with its own way of
+// reading the file from stdin.
+var (
+	cueFmt     = Command{Cmd: "cue", Args: []string{"fmt", "-"}, Stdout: true}
+	jsonnetFmt = Command{Cmd: "jsonnetfmt", Args: []string{"-"}, Stdout: true}
+	dhallFmt   = Command{Cmd: "dhall", Args: []string{"format"}, Stdout: true}
+)
+
+// commandBuiltin returns a builtin formatter running c on the file's
+// contents.
+func commandBuiltin(c Command) func(ctx context.Context, fm *Formatter, name string, src []byte) ([]byte, error) {
+	return func(ctx context.Context, fm *Formatter, name string, src []byte) ([]byte, error) {
+		return pipe(ctx, name, src, []Command{c})
+	}
+}
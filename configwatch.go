@@ -0,0 +1,129 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watcher watches the config files for changes.
+var watcher struct {
+	sync.Mutex
+	w *fsnotify.Watcher
+	// files holds the paths watched for, and anyIn the directories
+	// in which a change to any file counts.
+	files, anyIn map[string]bool
+	// dirs holds the directories added to w.
+	dirs map[string]bool
+}
+
+// configSettle is how long changes to the config files must stop
+// before they are reported, so a file is not read half written.
+const configSettle = 100 * time.Millisecond
+
+// watchConfig sends on changed whenever the config may have changed,
+// watching the directories of its files so that editors that replace
+// a file by renaming another over it are seen too. If a file is a
+// symlink, as into a dotfiles repository, the directory of its target
+// is watched as well. The fragment directory is watched for any
+// change.
+func watchConfig(changed chan<- struct{}) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	watcher.Lock()
+	watcher.w = w
+	watcher.files, watcher.anyIn, watcher.dirs = map[string]bool{}, map[string]bool{}, map[string]bool{}
+	watcher.Unlock()
+	if err := watchFiles(append([]string{configPath}, configFiles...)); err != nil {
+		w.Close()
+		return err
+	}
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		var settle *time.Timer
+		for {
+			hit := false
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				watcher.Lock()
+				hit = watcher.files[ev.Name] || watcher.anyIn[filepath.Dir(ev.Name)]
+				watcher.Unlock()
+			case _, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				// Events may have been lost.
+				hit = true
+			}
+			if !hit {
+				continue
+			}
+			if settle == nil {
+				settle = time.AfterFunc(configSettle, notify)
+			} else {
+				settle.Reset(configSettle)
+			}
+		}
+	}()
+	return nil
+}
+
+// watchFiles adds the config files paths, and the fragment directory,
+// to those watched. Watches are never removed; a file no longer
+// included costs only a spurious reread.
+func watchFiles(paths []string) error {
+	watcher.Lock()
+	defer watcher.Unlock()
+	if watcher.w == nil {
+		return nil
+	}
+	add := func(p string) error {
+		p, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		if dir := filepath.Dir(p); !watcher.dirs[dir] {
+			if err := watcher.w.Add(dir); err != nil {
+				return err
+			}
+			watcher.dirs[dir] = true
+		}
+		watcher.files[p] = true
+		return nil
+	}
+	for _, p := range paths {
+		if err := add(p); err != nil {
+			return err
+		}
+		if target, err := filepath.EvalSymlinks(p); err == nil && target != p {
+			if err := add(target); err != nil {
+				return err
+			}
+		}
+	}
+	frag, err := filepath.Abs(fragmentDir(configPath))
+	if err != nil {
+		return err
+	}
+	if err := add(frag); err != nil {
+		return err
+	}
+	if !watcher.dirs[frag] && watcher.w.Add(frag) == nil {
+		// It may not exist yet; its creation is seen in its parent.
+		watcher.dirs[frag] = true
+		watcher.anyIn[frag] = true
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"9fans.net/go/acme"
+)
+
+// conflicts returns the byte ranges of the unresolved merge conflicts
+// in src, each from its <<<<<<< line through its >>>>>>> line.
+func conflicts(src []byte) [][2]int {
+	var spans [][2]int
+	start, sep := -1, false
+	for off := 0; off < len(src); {
+		end := len(src)
+		if i := bytes.IndexByte(src[off:], '\n'); i >= 0 {
+			end = off + i + 1
+		}
+		line := src[off:end]
+		switch {
+		case bytes.HasPrefix(line, []byte("<<<<<<<")):
+			start, sep = off, false
+		case start >= 0 && bytes.HasPrefix(line, []byte("=======")):
+			sep = true
+		case start >= 0 && sep && bytes.HasPrefix(line, []byte(">>>>>>>")):
+			spans = append(spans, [2]int{start, end})
+			start = -1
+		}
+		off = end
+	}
+	return spans
+}
+
+// conflictLine returns the line of the first unresolved merge conflict
+// in src, or 0 if there is none.
+func conflictLine(src []byte) int {
+	c := conflicts(src)
+	if len(c) == 0 {
+		return 0
+	}
+	return bytes.Count(src[:c[0][0]], []byte("\n")) + 1
+}
+
+// resolveNext is the resolve control command. It selects the next
+// unresolved conflict after dot in window id, given as its argument,
+// wrapping around at the end.
+func resolveNext(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: resolve winid")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "", fmt.Errorf("bad window id %q", args[0])
+	}
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return "", err
+	}
+	defer w.CloseFiles()
+	body, err := w.ReadAll("body")
+	if err != nil {
+		return "", err
+	}
+	spans := conflicts(body)
+	if len(spans) == 0 {
+		return "no conflicts", nil
+	}
+	if err := w.Ctl("addr=dot"); err != nil {
+		return "", err
+	}
+	q0, _, err := w.ReadAddr()
+	if err != nil {
+		return "", err
+	}
+	// Addresses count runes.
+	next := 0
+	for i, s := range spans {
+		if utf8.RuneCount(body[:s[0]]) > q0 {
+			next = i
+			break
+		}
+	}
+	s := spans[next]
+	r0 := utf8.RuneCount(body[:s[0]])
+	r1 := r0 + utf8.RuneCount(body[s[0]:s[1]])
+	if err := w.Addr("#%d,#%d", r0, r1); err != nil {
+		return "", err
+	}
+	w.Ctl("dot=addr")
+	w.Ctl("show")
+	return fmt.Sprintf("conflict %d of %d", next+1, len(spans)), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// headSize is how much of a file is read to find its shebang and
+// modelines.
+const headSize = 4096
+
+var (
+	vimModeRe   = regexp.MustCompile(`\b(?:vim?|ex):.*\b(?:ft|filetype|syntax)=([\w.-]+)`)
+	emacsModeRe = regexp.MustCompile(`-\*-\s*(?:.*\bmode:\s*)?([\w+-]+)\s*(?:;.*)?-\*-`)
+)
+
+// interpreter returns the program named by the shebang line of src,
+// like "python3" for "#!/usr/bin/env python3", or "".
+func interpreter(src []byte) string {
+	if !bytes.HasPrefix(src, []byte("#!")) {
+		return ""
+	}
+	line := src[2:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	f := strings.Fields(string(line))
+	if len(f) == 0 {
+		return ""
+	}
+	prog := path.Base(f[0])
+	if prog == "env" {
+		prog = ""
+		for _, a := range f[1:] {
+			if !strings.HasPrefix(a, "-") && !strings.Contains(a, "=") {
+				prog = path.Base(a)
+				break
+			}
+		}
+	}
+	return prog
+}
+
+// modeline returns the file type named by a vim or emacs modeline in
+// the first or last five lines of src, or "".
+func modeline(src []byte) string {
+	lines := bytes.Split(src, []byte("\n"))
+	if n := len(lines); n > 10 {
+		lines = append(lines[:5:5], lines[n-5:]...)
+	}
+	for _, l := range lines {
+		if m := vimModeRe.FindSubmatch(l); m != nil {
+			return string(m[1])
+		}
+		if m := emacsModeRe.FindSubmatch(l); m != nil {
+			return strings.ToLower(string(m[1]))
+		}
+	}
+	return ""
+}
+
+// matchContent reports whether the file name's shebang or modeline
+// matches m's Shebang or Modeline globs.
+func (m *Matcher) matchContent(name string) bool {
+	if len(m.Shebang) == 0 && len(m.Modeline) == 0 {
+		return false
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, headSize)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	if prog := interpreter(head); prog != "" && matchAny(m.Shebang, prog) {
+		return true
+	}
+	if len(m.Modeline) == 0 {
+		return false
+	}
+	src := head
+	if info, err := f.Stat(); err == nil && info.Size() > headSize {
+		// Modelines may also be at the end.
+		tail := make([]byte, headSize)
+		if n, err := f.ReadAt(tail, info.Size()-headSize); err == nil || err == io.EOF {
+			src = append(append(head, '\n'), tail[:n]...)
+		}
+	}
+	if mode := modeline(src); mode != "" && matchAny(m.Modeline, mode) {
+		return true
+	}
+	return false
+}
+
+// matchAny reports whether s matches any of the globs in patterns.
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"9fans.net/go/plan9/client"
+)
+
+var replaceFlag = flag.Bool("replace", false, "replace an already running acmewatch instead of refusing to start")
+
+var errRunning = errors.New("acmewatch is already running; use -replace to take over or acmewatch ctl to talk to it")
+
+// controlPath returns the path of the control socket, kept in the
+// plan9port namespace directory so there is one per acme session. With
+// a custom config it is suffixed with a hash of the config path, so
+// instances with different configs run side by side.
+func controlPath() string {
+	name := "acmewatch"
+	if customConfig {
+		sum := sha256.Sum256([]byte(configPath))
+		name += fmt.Sprintf("-%x", sum[:4])
+	}
+	return filepath.Join(client.Namespace(), name)
+}
+
+type ctlRequest struct {
+	args  []string
+	reply chan string
+}
+
+// ctlRequests carries control commands to the main loop, which runs
+// them with runControl.
+var ctlRequests = make(chan ctlRequest)
+
+// controlCommands maps control command names to their handlers.
+var controlCommands = map[string]func(args []string) (string, error){
+	"ping":     func([]string) (string, error) { return "pong", nil },
+	"quit":     func([]string) (string, error) { return "ok", nil },
+	"disable":  func(args []string) (string, error) { return setDisabled(args, true) },
+	"enable":   func(args []string) (string, error) { return setDisabled(args, false) },
+	"rules":    listRules,
+	"queue":    listQueue,
+	"cancel":   cancelHook,
+	"showlast": showLast,
+	"status":   func([]string) (string, error) { return "ok", openStatus() },
+	"todo":     openTodo,
+	"tag":      tagLookup,
+	"outline":  openOutline,
+	"complete": completeWord,
+	"copy":     copyOutput,
+	"copysel":  copySelection,
+	"dump":     dumpCommand,
+	"resolve":  resolveNext,
+	"ann":      annotate,
+}
+
+// fileArgs maps the control commands that act on a file to the number
+// of arguments before it. Run from a window's tag without the file,
+// they are given the window's.
+var fileArgs = map[string]int{
+	"showlast": 0,
+	"todo":     0,
+	"tag":      1,
+	"outline":  0,
+	"copy":     0,
+}
+
+// windowArgs holds the control commands that act on a window itself,
+// to reach its dot. Run from a window's tag without the window id, they
+// are given the window's.
+var windowArgs = map[string]bool{
+	"complete": true,
+	"copysel":  true,
+	"resolve":  true,
+	"ann":      true,
+}
+
+// disabled holds the names of rules turned off with the disable
+// control command. It is not saved across restarts.
+var disabled = map[string]bool{}
+
+func setDisabled(args []string, off bool) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("missing rule name")
+	}
+	known := map[string]bool{}
+	for _, l := range ruleNames() {
+		known[l] = true
+	}
+	for _, a := range args {
+		if !known[a] {
+			return "", fmt.Errorf("unknown rule %q", a)
+		}
+	}
+	for _, a := range args {
+		if off {
+			disabled[a] = true
+		} else {
+			delete(disabled, a)
+		}
+	}
+	return "ok", nil
+}
+
+// listRules lists every configured rule, whether it is disabled, and
+// the version of its command if it has run.
+func listRules([]string) (string, error) {
+	var b strings.Builder
+	for _, l := range ruleNames() {
+		state := "enabled"
+		if disabled[l] {
+			state = "disabled"
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", l, state, ruleVersion(l))
+	}
+	return b.String(), nil
+}
+
+// listenControl claims the control socket, failing with errRunning if
+// another instance answers on it.
+func listenControl() (net.Listener, error) {
+	path := controlPath()
+	if reply, err := sendControl("ping"); err == nil && reply == "pong\n" {
+		if !*replaceFlag {
+			return nil, errRunning
+		}
+		sendControl("quit")
+		for i := 0; i < 50; i++ {
+			if _, err := sendControl("ping"); err != nil {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		shutdown(0)
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveControl(conn)
+		}
+	}()
+	return ln, nil
+}
+
+func serveControl(conn net.Conn) {
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return
+	}
+	switch args[0] {
+	case "subscribe":
+		serveSubscriber(conn, &eventBus)
+		return
+	case "log":
+		serveSubscriber(conn, &logBus)
+		return
+	}
+	reply := make(chan string, 1)
+	ctlRequests <- ctlRequest{args: args, reply: reply}
+	io.WriteString(conn, <-reply)
+	if args[0] == "quit" {
+		conn.Close()
+		shutdown(0)
+	}
+}
+
+// serveSubscriber streams the lines sent on bus to conn until it is
+// closed.
+func serveSubscriber(conn net.Conn, bus *broadcaster) {
+	c := bus.subscribe()
+	defer bus.unsubscribe(c)
+	closed := make(chan bool)
+	go func() {
+		io.Copy(ioutil.Discard, conn)
+		close(closed)
+	}()
+	for {
+		select {
+		case b := <-c:
+			if _, err := conn.Write(b); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// runControl runs a control request. It is called from the main loop.
+func runControl(req ctlRequest) {
+	fn := controlCommands[req.args[0]]
+	if fn == nil {
+		req.reply <- fmt.Sprintf("error: unknown command %q\n", req.args[0])
+		return
+	}
+	out, err := fn(req.args[1:])
+	if err != nil {
+		req.reply <- fmt.Sprintf("error: %s\n", err)
+		return
+	}
+	if out != "" && !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	req.reply <- out
+}
+
+// sendControl sends a command to the running instance and returns its
+// reply.
+func sendControl(args ...string) (string, error) {
+	var b strings.Builder
+	err := streamControl(&b, args...)
+	return b.String(), err
+}
+
+// streamControl sends a command to the running instance and copies its
+// reply to w as it arrives.
+func streamControl(w io.Writer, args ...string) error {
+	conn, err := net.DialTimeout("unix", controlPath(), time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintf(conn, "%s\n", strings.Join(args, " ")); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, conn)
+	return err
+}
+
+// shutdown removes the control socket, with -cleanup-on-exit deletes
+// the windows acmewatch created, and exits.
+func shutdown(code int) {
+	saveOnExit()
+	os.Remove(controlPath())
+	if *cleanupFlag {
+		deleteCreated()
+	}
+	os.Exit(code)
+}
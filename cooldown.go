@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Cooldown configures how rules whose tool keeps failing on a file are
+// turned off for it. After Failures consecutive failures the rule is
+// skipped for that file for Duration. It is off while Failures is 0.
+type Cooldown struct {
+	Failures int
+	Duration time.Duration
+}
+
+type failures struct {
+	n     int
+	until time.Time
+}
+
+var (
+	cooldownMu sync.Mutex
+	// cooldowns holds consecutive failures by rule and file.
+	cooldowns = map[string]*failures{}
+)
+
+// coolingDown reports whether rule is turned off for file, and until
+// when.
+func coolingDown(rule, file string) (time.Time, bool) {
+	cooldownMu.Lock()
+	defer cooldownMu.Unlock()
+	f := cooldowns[rule+"\x00"+file]
+	if f == nil || time.Now().After(f.until) {
+		return time.Time{}, false
+	}
+	return f.until, true
+}
+
+// recordOutcome counts a run of rule on file that failed if err is a
+// toolError, turning the rule off for the file once it has failed too
+// often. Other errors, like a linter's findings, count as runs that
+// worked: the tool did its job.
+func recordOutcome(rule, file string, err error) {
+	configMu.RLock()
+	c := config.Cooldown
+	configMu.RUnlock()
+	if c.Failures <= 0 {
+		return
+	}
+	var te *toolError
+	if !errors.As(err, &te) {
+		err = nil
+	}
+	key := rule + "\x00" + file
+	cooldownMu.Lock()
+	defer cooldownMu.Unlock()
+	if err == nil {
+		delete(cooldowns, key)
+		return
+	}
+	f := cooldowns[key]
+	if f == nil {
+		f = &failures{}
+		cooldowns[key] = f
+	}
+	f.n++
+	if f.n < c.Failures {
+		return
+	}
+	f.n = 0
+	f.until = time.Now().Add(c.Duration)
+	emit(Event{Event: "cooldown", File: file, Rule: rule, Outcome: "skipped", Message: fmt.Sprintf("failed %d times in a row; off for this file for %s", c.Failures, c.Duration)})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// setEncrypt fills in the get and put commands of an age or gpg
+// filter.
+func (f *Filter) setEncrypt() error {
+	switch f.Encrypt {
+	case "":
+		return nil
+	case "age":
+		if f.Identity == "" {
+			return errors.New("encrypt age: no identity")
+		}
+		f.Get = Command{Cmd: "age", Args: []string{"-d", "-i", f.Identity}, Stdout: true}
+		f.Put = Command{Cmd: "age", Args: []string{"-e"}, Stdout: true}
+		for _, r := range f.Recipients {
+			f.Put.Args = append(f.Put.Args, "-r", r)
+		}
+	case "gpg":
+		f.Get = Command{Cmd: "gpg", Args: []string{"--batch", "--quiet", "--decrypt"}, Stdout: true}
+		f.Put = Command{Cmd: "gpg", Args: []string{"--batch", "--quiet", "--yes", "--encrypt"}, Stdout: true}
+		for _, r := range f.Recipients {
+			f.Put.Args = append(f.Put.Args, "-r", r)
+		}
+	default:
+		return fmt.Errorf("unknown encrypt %q", f.Encrypt)
+	}
+	if len(f.Recipients) == 0 {
+		return fmt.Errorf("encrypt %s: no recipients", f.Encrypt)
+	}
+	return nil
+}
+
+// takeOverPut opens the event file of window id, showing the encrypted
+// file name, so that its Put commands reach acmewatch instead of acme,
+// which would write the plaintext. A Put to another file is refused.
+// Putall skips windows whose event file is open.
+func takeOverPut(id int, name string) {
+	st := getWindow(id)
+	if st.putTaken {
+		return
+	}
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	st.putTaken = true
+	go func() {
+		defer w.CloseFiles()
+		for e := range w.EventChan() {
+			f := strings.Fields(string(e.Text))
+			if (e.C2 != 'x' && e.C2 != 'X') || len(f) == 0 || f[0] != "Put" {
+				w.WriteEvent(e)
+				continue
+			}
+			// Put to another file, swept or chorded, would have acme
+			// write the plaintext there.
+			args := append(f[1:], strings.Fields(string(e.Arg))...)
+			if len(args) > 1 || (len(args) == 1 && args[0] != name) {
+				emitError(name, fmt.Errorf("Put %s: refusing to write the decrypted contents of %s to another file", strings.Join(args, " "), name))
+				continue
+			}
+			mainFuncs <- func() {
+				if err := encryptPut(w, name); err != nil {
+					emitError(name, err)
+				}
+			}
+		}
+	}()
+}
+
+// encryptPut encrypts the body of w and writes it to the file name.
+func encryptPut(w *acme.Win, name string) error {
+	f := filterFor(name)
+	if f == nil {
+		return errors.New("no encrypt filter")
+	}
+	body, err := w.ReadAll("body")
+	if err != nil {
+		return err
+	}
+	out, err := f.Put.run(name, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("put filter: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(name); os.IsNotExist(err) {
+		err = ioutil.WriteFile(name, out, 0600)
+	} else {
+		err = writeFile(name, out)
+	}
+	if err != nil {
+		return err
+	}
+	emit(Event{Event: "put", File: name, Outcome: "ok"})
+	return w.Ctl("clean")
+}
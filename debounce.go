@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	"9fans.net/go/acme"
+)
+
+type pendingPut struct {
+	event  acme.LogEvent
+	origin string
+	last   time.Time
+	timer  *time.Timer
+}
+
+var (
+	pendingPuts  = map[int]*pendingPut{}
+	debounceDone = make(chan int)
+)
+
+// debounce holds a put on its window until no other put has followed
+// it for config.Debounce, and reports whether it did. At that point
+// the window's id is sent on debounceDone; only the last put runs. A
+// del drops the window's held put.
+func debounce(event acme.LogEvent, origin string) bool {
+	if event.Op == "del" {
+		if p := pendingPuts[event.ID]; p != nil {
+			p.timer.Stop()
+			delete(pendingPuts, event.ID)
+		}
+		return false
+	}
+	if config.Debounce <= 0 || event.Op != "put" {
+		return false
+	}
+	p := pendingPuts[event.ID]
+	if p == nil {
+		p = new(pendingPut)
+		pendingPuts[event.ID] = p
+	} else {
+		p.timer.Stop()
+	}
+	p.event, p.origin, p.last = event, origin, time.Now()
+	id := event.ID
+	p.timer = time.AfterFunc(config.Debounce, func() { debounceDone <- id })
+	return true
+}
+
+// endDebounce returns the put held for window id, if no later put
+// restarted its wait.
+func endDebounce(id int) (acme.LogEvent, string, bool) {
+	p := pendingPuts[id]
+	if p == nil || time.Since(p.last) < config.Debounce {
+		return acme.LogEvent{}, "", false
+	}
+	delete(pendingPuts, id)
+	return p.event, p.origin, true
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// debugFlag is set by -v or -debug.
+var debugFlag bool
+
+func init() {
+	flag.BoolVar(&debugFlag, "v", false, "log every event, why each rule did or did not match, and the commands run")
+	flag.BoolVar(&debugFlag, "debug", false, "same as -v")
+}
+
+// debugf logs its arguments, formatted as by fmt.Sprintf, with -v.
+func debugf(format string, args ...interface{}) {
+	if debugFlag {
+		log.Printf("debug: "+format, args...)
+	}
+}
+
+// why explains whether m matches name, for -v.
+func (m *Matcher) why(name string) string {
+	if excluded(m.Exclude, name) {
+		return "excluded by the rule's exclude"
+	}
+	if m.re != nil && m.re.MatchString(name) {
+		return fmt.Sprintf("matches match_re %q", m.MatchRe)
+	}
+	for _, g := range m.Match {
+		if ok, _ := match([]string{g}, name); ok {
+			return fmt.Sprintf("matches %q", g)
+		}
+	}
+	if m.matchContent(name) {
+		return "matches shebang or modeline"
+	}
+	return fmt.Sprintf("does not match %q", m.Match)
+}
+
+// quoteArgs returns argv as a shell-like command line.
+func quoteArgs(argv []string) string {
+	q := make([]string, len(argv))
+	for i, a := range argv {
+		q[i] = a
+		if a == "" || strings.ContainsAny(a, " \t\n'\"\\$`|&;<>()*?[]#~") {
+			q[i] = strconv.Quote(a)
+		}
+	}
+	return strings.Join(q, " ")
+}
+
+// errOrOK returns err, or "ok" if it is nil.
+func errOrOK(err error) interface{} {
+	if err == nil {
+		return "ok"
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+package main
+
+import "strings"
+
+// internalDiff returns, in order, the hunks that turn old into new,
+// found with Myers' algorithm over their lines.
+func internalDiff(old, new []byte) []hunk {
+	a, b := diffLines(old), diffLines(new)
+	var hunks []hunk
+	i, j := 0, 0
+	for _, m := range matchLines(a, b) {
+		if m[0] > i || m[1] > j {
+			hunks = append(hunks, makeHunk(i, m[0], j, m[1]))
+		}
+		i, j = m[0]+1, m[1]+1
+	}
+	if i < len(a) || j < len(b) {
+		hunks = append(hunks, makeHunk(i, len(a), j, len(b)))
+	}
+	return hunks
+}
+
+// makeHunk returns the hunk replacing old lines [i, i2) with new lines
+// [j, j2), counted from 0.
+func makeHunk(i, i2, j, j2 int) hunk {
+	switch {
+	case i == i2:
+		return hunk{op: 'a', oldStart: i, oldEnd: i, newStart: j + 1, newEnd: j2}
+	case j == j2:
+		return hunk{op: 'd', oldStart: i + 1, oldEnd: i2, newStart: j, newEnd: j}
+	}
+	return hunk{op: 'c', oldStart: i + 1, oldEnd: i2, newStart: j + 1, newEnd: j2}
+}
+
+// diffLines splits text into lines, each with its newline, if any.
+func diffLines(text []byte) []string {
+	lines := strings.SplitAfter(string(text), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines returns, in order, the index pairs of the lines of a and
+// b kept by a shortest edit script turning a into b.
+func matchLines(a, b []string) [][2]int {
+	// Common prefix and suffix lines match trivially and are left out
+	// of the search.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var matches [][2]int
+	for i := 0; i < pre; i++ {
+		matches = append(matches, [2]int{i, i})
+	}
+	for _, m := range myers(a[pre:len(a)-suf], b[pre:len(b)-suf]) {
+		matches = append(matches, [2]int{m[0] + pre, m[1] + pre})
+	}
+	for i := suf; i > 0; i-- {
+		matches = append(matches, [2]int{len(a) - i, len(b) - i})
+	}
+	return matches
+}
+
+// myers returns the matching line pairs of a shortest edit script
+// turning a into b. It uses the linear space refinement of Myers'
+// algorithm: the middle snake of a shortest edit script splits the
+// search in two, so memory is O(N+M) however many lines differ.
+func myers(a, b []string) [][2]int {
+	// Compare lines by number rather than by contents.
+	ids := map[string]int{}
+	number := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	d := &differ{a: number(a)}
+	inA := len(ids)
+	d.b = number(b)
+	// With no line in common, as when every line ending changed, there
+	// is nothing to search for.
+	common := false
+	for _, id := range d.b {
+		if id < inA {
+			common = true
+			break
+		}
+	}
+	if !common {
+		return nil
+	}
+	max := len(a) + len(b) + 1
+	d.vf, d.vb = make([]int, 2*max+1), make([]int, 2*max+1)
+	d.off = max
+	d.compare(0, len(a), 0, len(b))
+	return d.matches
+}
+
+// A differ finds the matching lines of a and b.
+type differ struct {
+	a, b []int
+	// vf and vb hold, by diagonal plus off, the furthest x reached
+	// forward from the start and backward from the end.
+	vf, vb  []int
+	off     int
+	matches [][2]int
+}
+
+// compare appends, in order, the matching line pairs of a[a0:a1] and
+// b[b0:b1].
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.matches = append(d.matches, [2]int{a0, b0})
+		a0, b0 = a0+1, b0+1
+	}
+	suf := 0
+	for a0 < a1-suf && b0 < b1-suf && d.a[a1-1-suf] == d.b[b1-1-suf] {
+		suf++
+	}
+	a1, b1 = a1-suf, b1-suf
+	if a0 < a1 && b0 < b1 {
+		x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.matches = append(d.matches, [2]int{x, y})
+		}
+		d.compare(u, a1, v, b1)
+	}
+	for i := 0; i < suf; i++ {
+		d.matches = append(d.matches, [2]int{a1 + i, b1 + i})
+	}
+}
+
+// maxDiffCost bounds the edit distance middleSnake searches to, so that
+// time stays bounded on files that are nearly rewritten. Beyond it the
+// region searched becomes one change.
+const maxDiffCost = 4096
+
+// middleSnake returns the start (x, y) and end (u, v) of the middle
+// snake of a shortest edit script turning a[a0:a1] into b[b0:b1],
+// found by searching forward from the start and backward from the end
+// until the two searches overlap.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta&1 != 0
+	vf, vb, off := d.vf, d.vb, d.off
+	vf[off+1], vb[off+1] = 0, 0
+	for D := 0; D <= (n+m+1)/2; D++ {
+		if D > maxDiffCost {
+			// Too costly to search on: replace all of a[a0:a1]
+			// with b[b0:b1] instead.
+			return a1, b0, a1, b0
+		}
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x, y = x+1, y+1
+			}
+			vf[off+k] = x
+			// Backward diagonal delta-k has had D-1 steps.
+			if kb := delta - k; odd && kb >= -(D-1) && kb <= D-1 && x+vb[off+kb] >= n {
+				return a0 + sx, b0 + sy, a0 + x, b0 + y
+			}
+		}
+		// Backward, x and y count lines from the end.
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[a1-1-x] == d.b[b1-1-y] {
+				x, y = x+1, y+1
+			}
+			vb[off+k] = x
+			if kf := delta - k; !odd && kf >= -D && kf <= D && x+vf[off+kf] >= n {
+				return a1 - x, b1 - y, a1 - sx, b1 - sy
+			}
+		}
+	}
+	panic("diff: no middle snake")
+}
+
+// mapOffset maps rune offset q in old to the corresponding offset in
+// new, which hunks turn old into. An offset in unchanged text keeps its
+// line and column; one in changed lines moves to the same column of
+// the replacing line, or to the start of the line after a deletion.
+func mapOffset(old, new []byte, hunks []hunk, q int) int {
+	line, col := 1, 0
+	for _, r := range string(old) {
+		if q == 0 {
+			break
+		}
+		q--
+		col++
+		if r == '\n' {
+			line, col = line+1, 0
+		}
+	}
+	target := line
+	for _, h := range hunks {
+		added := h.newEnd - h.newStart + 1
+		if h.op == 'd' {
+			added = 0
+		}
+		if h.op == 'a' {
+			if line > h.oldStart {
+				target += added
+			}
+			continue
+		}
+		if line > h.oldEnd {
+			target += added - (h.oldEnd - h.oldStart + 1)
+			continue
+		}
+		if line >= h.oldStart {
+			if h.op == 'd' {
+				target, col = h.newStart+1, 0
+			} else {
+				target = h.newStart + line - h.oldStart
+				if target > h.newEnd {
+					target = h.newEnd
+				}
+			}
+		}
+		break
+	}
+	off := 0
+	line = 1
+	for _, r := range string(new) {
+		if line == target {
+			if col == 0 || r == '\n' {
+				break
+			}
+			col--
+		}
+		off++
+		if r == '\n' {
+			line++
+		}
+	}
+	return off
+}
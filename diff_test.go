@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// fakeWindow is an acme window body that understands the addresses
+// applyHunks uses.
+type fakeWindow struct {
+	body   []byte
+	q0, q1 int
+	// ops logs the addresses set and the writes made.
+	ops []string
+}
+
+func (w *fakeWindow) Addr(format string, args ...interface{}) error {
+	addr := fmt.Sprintf(format, args...)
+	w.ops = append(w.ops, "addr "+addr)
+	var n, m int
+	switch {
+	case strings.HasSuffix(addr, "+#0"):
+		if _, err := fmt.Sscanf(addr, "%d+#0", &n); err != nil {
+			return err
+		}
+		_, q1, err := w.line(n)
+		if err != nil {
+			return err
+		}
+		w.q0, w.q1 = q1, q1
+	default:
+		if _, err := fmt.Sscanf(addr, "%d,%d", &n, &m); err != nil {
+			return err
+		}
+		q0, _, err := w.line(n)
+		if err != nil {
+			return err
+		}
+		_, q1, err := w.line(m)
+		if err != nil {
+			return err
+		}
+		w.q0, w.q1 = q0, q1
+	}
+	return nil
+}
+
+// line returns the span of line n, with its newline, as acme does: line
+// 0 is the empty span at the start.
+func (w *fakeWindow) line(n int) (q0, q1 int, err error) {
+	if n == 0 {
+		return 0, 0, nil
+	}
+	p := 0
+	for l := 1; l < n; l++ {
+		i := bytes.IndexByte(w.body[p:], '\n')
+		if i < 0 {
+			return 0, 0, fmt.Errorf("address out of range: %d", n)
+		}
+		p += i + 1
+	}
+	q1 = len(w.body)
+	if i := bytes.IndexByte(w.body[p:], '\n'); i >= 0 {
+		q1 = p + i + 1
+	}
+	return p, q1, nil
+}
+
+func (w *fakeWindow) Write(file string, b []byte) (int, error) {
+	w.ops = append(w.ops, fmt.Sprintf("%s %q", file, b))
+	if file != "data" {
+		return len(b), nil
+	}
+	body := append([]byte{}, w.body[:w.q0]...)
+	body = append(body, b...)
+	w.body = append(body, w.body[w.q1:]...)
+	w.q0 += len(b)
+	w.q1 = w.q0
+	return len(b), nil
+}
+
+// checkPatch diffs old and new, applies the hunks to a fake window
+// holding old, and checks that it ends up holding new.
+func checkPatch(t *testing.T, old, new []byte) {
+	t.Helper()
+	w := &fakeWindow{body: append([]byte{}, old...)}
+	applyHunks(w, new, internalDiff(old, new), "hunk")
+	if !bytes.Equal(w.body, new) {
+		t.Fatalf("patching %q into %q gave %q", old, new, w.body)
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	for _, tt := range []struct{ old, new string }{
+		{"", ""},
+		{"", "a\n"},
+		{"a\n", ""},
+		{"a\n", "b\na\n"},
+		{"a\nb\n", "b\n"},
+		{"a\nb\nc\n", "a\nc\nd\n"},
+		{"a", "a\n"},
+		{"a\n", "a"},
+		{"a\nb", "a\nc"},
+	} {
+		checkPatch(t, []byte(tt.old), []byte(tt.new))
+	}
+}
+
+// TestApplyHunksRandom patches random texts, built from few distinct
+// lines so that they share many, into each other.
+func TestApplyHunksRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	text := func() []byte {
+		var b bytes.Buffer
+		for i, n := 0, r.Intn(12); i < n; i++ {
+			b.WriteString("abcd"[r.Intn(4):][:1])
+			if i < n-1 || r.Intn(4) > 0 {
+				b.WriteByte('\n')
+			}
+		}
+		return b.Bytes()
+	}
+	for i := 0; i < 5000; i++ {
+		checkPatch(t, text(), text())
+	}
+}
+
+func FuzzApplyHunks(f *testing.F) {
+	f.Add([]byte("a\nb\nc\n"), []byte("a\nc\nd\n"))
+	f.Add([]byte(""), []byte("x"))
+	f.Add([]byte("x\ny"), []byte("y\nx\n"))
+	f.Fuzz(func(t *testing.T, old, new []byte) {
+		checkPatch(t, old, new)
+	})
+}
+
+func TestMapOffset(t *testing.T) {
+	for _, tt := range []struct {
+		old, new string
+		q, want  int
+	}{
+		// Unchanged text keeps its line and column.
+		{"ab\ncd\n", "ab\ncd\n", 4, 4},
+		{"é\nb\n", "é\nb\n", 3, 3},
+		{"a\nb\nc\n", "a\nB\nc\n", 1, 1},
+		{"a\nb\nc\n", "a\nB\nc\n", 4, 4},
+		// Lines added or removed above move it.
+		{"a\nb\n", "x\ny\na\nb\n", 3, 7},
+		{"x\na\nb\n", "a\nb\n", 5, 3},
+		// A changed line keeps the column.
+		{"ab\nxyz\n", "ab\nXYZW\n", 5, 5},
+		{"ab\nxyz\n", "ab\nX\n", 5, 4},
+		// A deleted line moves it to the start of the line after.
+		{"a\nb\nc\n", "a\nc\n", 3, 2},
+	} {
+		old, new := []byte(tt.old), []byte(tt.new)
+		if got := mapOffset(old, new, internalDiff(old, new), tt.q); got != tt.want {
+			t.Errorf("mapOffset(%q, %q, %d) = %d, want %d", tt.old, tt.new, tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// diff returns, in order, the hunks that turn old into new, using the
+// first command of diff_cmd that runs and parses.
+func diff(old, new []byte) []hunk {
+	configMu.RLock()
+	cmds := config.DiffCmd
+	configMu.RUnlock()
+	for _, c := range cmds {
+		argv := strings.Fields(c)
+		if len(argv) == 0 || argv[0] == "internal" {
+			break
+		}
+		hunks, err := externalDiff(argv, old, new)
+		if err == nil {
+			return hunks
+		}
+		log.Printf("diff_cmd %q: %v", c, err)
+	}
+	return internalDiff(old, new)
+}
+
+// externalDiff runs argv on temporary copies of old and new and parses
+// its output, in the normal format printed by both 9 diff and GNU diff.
+func externalDiff(argv []string, old, new []byte) ([]hunk, error) {
+	bin, err := exec.LookPath(expandTilde(argv[0]))
+	if err != nil {
+		return nil, err
+	}
+	oldTmp, err := diffTemp(old)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(oldTmp)
+	newTmp, err := diffTemp(new)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(newTmp)
+
+	args := append(argv[1:len(argv):len(argv)], oldTmp, newTmp)
+	out, err := exec.Command(bin, args...).Output()
+	// Both report differences with exit status 1.
+	var ee *exec.ExitError
+	if errors.As(err, &ee) && ee.ExitCode() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseDiff(out)
+}
+
+// diffTemp writes data to a new temporary file and returns its path.
+func diffTemp(data []byte) (string, error) {
+	f, err := ioutil.TempFile("", "acmewatch-diff-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+var diffCommandRe = regexp.MustCompile(`^(\d+)(?:,(\d+))?([acd])(\d+)(?:,(\d+))?$`)
+
+// parseDiff parses normal diff output into hunks. The text lines (<
+// and >), separators (---), and "\ No newline" markers are skipped.
+func parseDiff(out []byte) ([]hunk, error) {
+	var hunks []hunk
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" || strings.HasPrefix(line, "<") || strings.HasPrefix(line, ">") ||
+			line == "---" || strings.HasPrefix(line, `\`) {
+			continue
+		}
+		m := diffCommandRe.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("cannot parse diff line %q", line)
+		}
+		h := hunk{op: m[3][0]}
+		h.oldStart, h.oldEnd = diffSpan(m[1], m[2])
+		h.newStart, h.newEnd = diffSpan(m[4], m[5])
+		hunks = append(hunks, h)
+	}
+	return hunks, nil
+}
+
+// diffSpan returns the line range start[,end]. A single line is its
+// own end.
+func diffSpan(start, end string) (int, int) {
+	s, _ := strconv.Atoi(start)
+	if end == "" {
+		return s, s
+	}
+	e, _ := strconv.Atoi(end)
+	return s, e
+}
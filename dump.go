@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var dumpFlag = flag.String("dump", "", "save acmewatch's state next to the acme dump `file` on exit, and restore it at startup")
+
+// dumpState is acmewatch's state saved alongside an acme dump file, so
+// that acme -l restores both the windows and what acmewatch knew of
+// them.
+type dumpState struct {
+	Saved    time.Time
+	Disabled []string
+	// History holds the formatting history of the windows by file
+	// name.
+	History map[string][]dumpApplied
+}
+
+type dumpApplied struct {
+	Time     time.Time
+	Rule     string
+	Old, New []byte
+}
+
+// restoredHistory holds the formatting history read from a dump, by
+// file name, until a window on the file appears.
+var restoredHistory = map[string][]applied{}
+
+// dumpPath returns the acme dump file to save state along with: file,
+// if set, or -dump, or acme's default, $HOME/acme.dump.
+func dumpPath(file string) string {
+	if file == "" {
+		file = *dumpFlag
+	}
+	if file == "" {
+		home, _ := os.UserHomeDir()
+		file = filepath.Join(home, "acme.dump")
+	}
+	return file
+}
+
+// stateFile returns the file acmewatch's state is saved in for the
+// acme dump file dump.
+func stateFile(dump string) string {
+	return dump + ".acmewatch"
+}
+
+// saveState writes acmewatch's state for the acme dump file dump. It
+// must run in the main loop.
+func saveState(dump string) error {
+	st := dumpState{Saved: time.Now(), History: map[string][]dumpApplied{}}
+	for r := range disabled {
+		st.Disabled = append(st.Disabled, r)
+	}
+	sort.Strings(st.Disabled)
+	for _, w := range windowState {
+		if w.name == "" {
+			continue
+		}
+		for _, a := range w.history {
+			st.History[w.name] = append(st.History[w.name], dumpApplied{a.time, a.rule, a.old, a.new})
+		}
+	}
+	b, err := json.MarshalIndent(st, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(stateFile(dump), b, 0600)
+}
+
+// loadState restores the state saved for the acme dump file dump, if
+// any.
+func loadState(dump string) error {
+	b, err := ioutil.ReadFile(stateFile(dump))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var st dumpState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return err
+	}
+	for _, r := range st.Disabled {
+		disabled[r] = true
+	}
+	for name, hist := range st.History {
+		for _, a := range hist {
+			restoredHistory[name] = append(restoredHistory[name], applied{a.Time, a.Rule, a.Old, a.New})
+		}
+	}
+	return nil
+}
+
+// restoreWindow gives window w, just named, the history restored for
+// its file.
+func restoreWindow(w *window) {
+	if h, ok := restoredHistory[w.name]; ok && len(w.history) == 0 {
+		w.history = h
+		delete(restoredHistory, w.name)
+	}
+}
+
+// dumpCommand is the dump control command: dump [file]. It saves
+// acmewatch's state next to the acme dump file, by default -dump or
+// $HOME/acme.dump; run it along with acme's Dump.
+func dumpCommand(args []string) (string, error) {
+	if len(args) > 1 {
+		return "", errors.New("usage: dump [file]")
+	}
+	file := ""
+	if len(args) == 1 {
+		file = args[0]
+	}
+	dump := dumpPath(file)
+	if err := saveState(dump); err != nil {
+		return "", err
+	}
+	return stateFile(dump), nil
+}
+
+// saveOnExit saves state for -dump, if set, as acmewatch exits. It may
+// be called from any goroutine; the main loop does the saving.
+func saveOnExit() {
+	if *dumpFlag == "" {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case mainFuncs <- func() {
+		if err := saveState(*dumpFlag); err != nil {
+			log.Print(err)
+		}
+		close(done)
+	}:
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	case <-time.After(time.Second):
+		log.Print("main loop busy; state not saved")
+	}
+}
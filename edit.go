@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// editScript returns acme Edit commands that turn old, the contents of
+// the window for the file name, into new. There is one command per
+// line, bottom hunk first, so executing them in order keeps later line
+// numbers valid. Each addresses the window by its menu line, which X
+// matches, and which ends with a space and the file name.
+func editScript(name string, old, new []byte, hunks []hunk) []byte {
+	var b bytes.Buffer
+	win := "X/ " + editRegexp(name) + "$/"
+	for i := len(hunks) - 1; i >= 0; i-- {
+		h := hunks[i]
+		text := editText(findLines(new, h.newStart, h.newEnd))
+		switch h.op {
+		case 'a':
+			fmt.Fprintf(&b, "Edit %s %da/%s/\n", win, h.oldStart, text)
+		case 'c':
+			fmt.Fprintf(&b, "Edit %s %d,%dc/%s/\n", win, h.oldStart, h.oldEnd, text)
+		case 'd':
+			fmt.Fprintf(&b, "Edit %s %d,%dd\n", win, h.oldStart, h.oldEnd)
+		}
+	}
+	return b.Bytes()
+}
+
+// editText escapes text for use between slashes in an Edit command.
+func editText(text []byte) string {
+	r := strings.NewReplacer(`\`, `\\`, `/`, `\/`, "\n", `\n`)
+	return r.Replace(string(text))
+}
+
+// editRegexp escapes s for use as a literal in an acme regular
+// expression between slashes.
+func editRegexp(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`\.*+?[]()|^$/`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// showEditScript writes the Edit commands turning old into new into a
+// window named name+"+Edit".
+func showEditScript(name string, old, new []byte, hunks []hunk) {
+	ename := name + "+Edit"
+	w := acme.Show(ename)
+	if w == nil {
+		var err error
+		if w, err = newWindow(ename); err != nil {
+			log.Print(err)
+			return
+		}
+	}
+	w.Addr(",")
+	w.Write("data", editScript(name, old, new, hunks))
+	w.Ctl("clean")
+	w.Addr("#0")
+	w.Ctl("dot=addr")
+	w.Ctl("show")
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestEditScript(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		old, new string
+		hunks    []hunk
+		want     string
+	}{
+		{
+			"/src/a.go", "a\nb\nc\n", "a\nB\nc\nd\n",
+			[]hunk{{'c', 2, 2, 2, 2}, {'a', 3, 3, 4, 4}},
+			`Edit X/ \/src\/a\.go$/ 3a/d\n/` + "\n" +
+				`Edit X/ \/src\/a\.go$/ 2,2c/B\n/` + "\n",
+		},
+		{
+			"/src/x", "a\nb\nc\n", "c\n",
+			[]hunk{{'d', 1, 2, 0, 0}},
+			`Edit X/ \/src\/x$/ 1,2d` + "\n",
+		},
+		{
+			"/a b/c:d(1)+.txt", "a\n", "a/b\\\n",
+			[]hunk{{'c', 1, 1, 1, 1}},
+			`Edit X/ \/a b\/c:d\(1\)\+\.txt$/ 1,1c/a\/b\\\n/` + "\n",
+		},
+	} {
+		got := string(editScript(tt.name, []byte(tt.old), []byte(tt.new), tt.hunks))
+		if got != tt.want {
+			t.Errorf("editScript(%q, %q, %q) = %q, want %q", tt.name, tt.old, tt.new, got, tt.want)
+		}
+	}
+}
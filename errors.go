@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"sync"
+
+	"9fans.net/go/acme"
+)
+
+// globalErrors is the +Errors window used by errors = "global".
+const globalErrors = "/acmewatch/+Errors"
+
+// routeErrors is set once acmewatch is watching acme, so subcommands
+// like fmt-all keep printing their output.
+var routeErrors bool
+
+// errorsMu keeps two writers from both opening a missing window.
+var errorsMu sync.Mutex
+
+// errorsDir returns the directory whose +Errors window shows output
+// for file, by the errors setting, or "" to print it instead, as in
+// observe mode.
+func errorsDir(file string) string {
+	configMu.RLock()
+	policy := config.Errors
+	configMu.RUnlock()
+	switch {
+	case !routeErrors || policy == "stdout" || file == "" || observing():
+		return ""
+	case policy == "global":
+		return filepath.Dir(globalErrors)
+	}
+	return filepath.Dir(file)
+}
+
+// showErrors appends text to the +Errors window of dir, opening one if
+// there is none, as acme does for the output of commands run in dir.
+func showErrors(dir string, text []byte) error {
+	if len(text) == 0 {
+		return nil
+	}
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	if !bytes.HasSuffix(text, []byte("\n")) {
+		text = append(text[:len(text):len(text)], '\n')
+	}
+	name := filepath.Join(dir, "+Errors")
+	var w *acme.Win
+	windows, err := acme.Windows()
+	if err != nil {
+		return err
+	}
+	for _, wi := range windows {
+		if wi.Name == name {
+			if w, err = acme.Open(wi.ID, nil); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if w == nil {
+		if w, err = newWindow(name); err != nil {
+			return err
+		}
+	}
+	defer w.CloseFiles()
+	if err := w.Addr("$"); err != nil {
+		return err
+	}
+	if _, err := w.Write("data", text); err != nil {
+		return err
+	}
+	w.Ctl("clean")
+	return w.Ctl("show")
+}
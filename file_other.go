@@ -0,0 +1,33 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func chown(name string, info os.FileInfo) {}
+
+func writable(name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(p *os.Process) {
+	p.Kill()
+}
+
+func restart() error {
+	return errors.New("not supported on this system")
+}
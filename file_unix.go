@@ -0,0 +1,45 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// chown gives name the owner and group in info, ignoring errors since
+// only root can give files away.
+func chown(name string, info os.FileInfo) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		os.Lchown(name, int(st.Uid), int(st.Gid))
+	}
+}
+
+// writable reports an error if name cannot be written by this process,
+// including when it is marked immutable.
+func writable(name string) error {
+	const wOK = 2 // W_OK from unistd.h
+	return syscall.Access(name, wOK)
+}
+
+// setProcessGroup makes cmd start a process group of its own.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills the process group led by p.
+func killProcessGroup(p *os.Process) {
+	syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
+
+// restart replaces this process with a new acmewatch run with the same
+// arguments.
+func restart() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"9fans.net/go/acme"
+)
+
+// A Filter transforms a file for viewing when a window loads it, and
+// back when the window is put, as for encrypted or minified files.
+type Filter struct {
+	Matcher
+	// Get turns the file's contents, on stdin, into what the window
+	// shows.
+	Get Command
+	// Put turns the window's contents, on stdin, back into what is
+	// stored.
+	Put Command
+	// Encrypt, if "age" or "gpg", fills in Get and Put to decrypt and
+	// encrypt the file. Puts are then taken over from acme so the
+	// plaintext is never written to disk.
+	Encrypt string
+	// Identity is the age identity file to decrypt with.
+	Identity string
+	// Recipients are the age recipients or gpg key IDs to encrypt to.
+	Recipients []string
+	// Minified, if "js", "css", or "json", fills in Get and Put, where
+	// unset, to prettify the file for editing and minify it again.
+	Minified string
+	// KeepPretty leaves a Minified file prettified when it is put.
+	KeepPretty bool `toml:"keep_pretty"`
+}
+
+// filterFor returns the filter matching name, or nil if none does or
+// in observe mode, since filters rewrite windows and files.
+func filterFor(name string) *Filter {
+	cfg, err := configFor(name)
+	if err != nil || cfg.Observe {
+		return nil
+	}
+	for _, f := range cfg.Filter {
+		if matched, _ := f.matches(name); matched {
+			return f
+		}
+	}
+	return nil
+}
+
+// filterGet runs the get filter of name, if any, on the file and shows
+// the result in window id, which has just loaded it.
+func filterGet(id int, name string) error {
+	f := filterFor(name)
+	if f == nil || f.Get.Cmd == "" {
+		return nil
+	}
+	if f.Encrypt != "" {
+		takeOverPut(id, name)
+	}
+	stored, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) && f.Encrypt != "" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return err
+	}
+	defer w.CloseFiles()
+	out, err := f.Get.run(name, bytes.NewReader(stored))
+	if err != nil {
+		return fmt.Errorf("get filter: %v\n%s", err, out)
+	}
+	if err := w.Addr(","); err != nil {
+		return err
+	}
+	w.Write("data", out)
+	w.Ctl("clean")
+	w.Addr("#0")
+	w.Ctl("dot=addr")
+	w.Ctl("show")
+	return nil
+}
+
+// filterPut runs the put filter of name, if any, on the body of window
+// id, once its formatting is applied, and writes the result to the
+// file. The window is then reloaded, which runs the get filter, so it
+// shows the stored contents and is clean.
+func filterPut(id int, name string) error {
+	f := filterFor(name)
+	if f == nil || f.Put.Cmd == "" || f.Encrypt != "" {
+		return nil
+	}
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return err
+	}
+	defer w.CloseFiles()
+	body, err := w.ReadAll("body")
+	if err != nil {
+		return err
+	}
+	out, err := f.Put.run(name, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("put filter: %v\n%s", err, out)
+	}
+	if err := writeFile(name, out); err != nil {
+		return err
+	}
+	if err := w.Ctl("get"); err != nil {
+		log.Print(err)
+	}
+	return nil
+}
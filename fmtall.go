@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// fmtAll runs the matching formatters over every tracked file
+// under dir. Files open in a clean acme window are reformatted in the
+// window; other files are rewritten on disk.
+func fmtAll(dir string) error {
+	if err := readConfig(); err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	files, err := trackedFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	open := map[string]int{}
+	if wins, err := acme.Windows(); err == nil {
+		for _, wi := range wins {
+			open[wi.Name] = wi.ID
+		}
+	}
+
+	var changed, inWindow, unchanged, failed, skipped int
+	for _, name := range files {
+		fms, err := findFormatters(name)
+		if err != nil {
+			return err
+		}
+		if len(fms) == 0 {
+			continue
+		}
+		if why := formatOff(name); why != "" {
+			emit(Event{Event: "fmt-all", File: name, Outcome: "skipped", Message: "formatting off: " + why})
+			skipped++
+			continue
+		}
+		old, err := ioutil.ReadFile(name)
+		if err != nil {
+			emitError(name, err)
+			failed++
+			continue
+		}
+		if line := conflictLine(old); line > 0 {
+			emit(Event{Event: "fmt-all", File: name, Outcome: "skipped", Message: fmt.Sprintf("unresolved conflict at line %d; skipped", line)})
+			skipped++
+			continue
+		}
+		out, fm, err := formatWith(fms, name, old)
+		if err != nil {
+			emit(Event{Event: "fmt-all", File: name, Rule: fm.Name, Outcome: "failed", Message: err.Error(), Diagnostics: string(out)})
+			failed++
+			continue
+		}
+		if bytes.Equal(old, out) {
+			emit(Event{Event: "fmt-all", File: name, Rule: fm.Name, Outcome: "unchanged"})
+			unchanged++
+			continue
+		}
+		dry := false
+		for _, f := range fms {
+			dry = dry || dryRun(f)
+		}
+		if dry {
+			wouldChange("fmt-all", name, fm, old, out)
+			changed++
+			continue
+		}
+		if id, ok := open[name]; ok {
+			if windowDirty(id) {
+				emit(Event{Event: "fmt-all", File: name, Rule: fm.Name, Outcome: "skipped", Message: "window has unsaved changes; skipped"})
+				skipped++
+				continue
+			}
+			reformat(id, name, out)
+			inWindow++
+		} else {
+			if err := writable(name); err != nil {
+				emit(Event{Event: "fmt-all", File: name, Rule: fm.Name, Outcome: "skipped", Message: fmt.Sprintf("not writable (%s); skipped; to fix: chmod u+w %s", err, name)})
+				skipped++
+				continue
+			}
+			if err := writeFile(name, out); err != nil {
+				emitError(name, err)
+				failed++
+				continue
+			}
+		}
+		emit(Event{Event: "fmt-all", File: name, Rule: fm.Name, Outcome: "changed", Message: "formatted"})
+		changed++
+	}
+	msg := fmt.Sprintf("%d formatted (%d in windows), %d unchanged, %d skipped, %d failed",
+		changed, inWindow, unchanged, skipped, failed)
+	if *dryRunFlag {
+		msg = "dry run: " + msg
+	}
+	emit(Event{Event: "summary", Message: msg})
+	return nil
+}
+
+// formatWith runs fms in turn on old, the contents of the file name,
+// and returns the result. On failure it returns the failing
+// formatter's output and the formatter. It returns the last formatter
+// otherwise.
+func formatWith(fms []*Formatter, name string, old []byte) ([]byte, *Formatter, error) {
+	out := old
+	for _, fm := range fms {
+		var err error
+		if out, err = fm.output(name, out); err != nil {
+			return out, fm, err
+		}
+	}
+	return out, fms[len(fms)-1], nil
+}
+
+// findFormatters returns the enabled formatters matching name, in
+// order. Unless the formatters policy is "all", it stops at the first,
+// but a formatter's then setting, "stop" or "continue", overrides the
+// policy.
+func findFormatters(name string) ([]*Formatter, error) {
+	cfg, err := configFor(name)
+	if err != nil {
+		return nil, err
+	}
+	if excluded(cfg.Exclude, name) {
+		debugf("%s: excluded by the top-level exclude", name)
+		return nil, nil
+	}
+	var fms []*Formatter
+	for _, fm := range cfg.Formatter {
+		if disabled[fm.Name] {
+			debugf("%s: formatter %s: disabled", name, fm.Name)
+			continue
+		}
+		matched, err := fm.matches(name)
+		if err != nil {
+			return nil, err
+		}
+		if debugFlag {
+			debugf("%s: formatter %s: %s", name, fm.Name, fm.why(name))
+		}
+		if !matched {
+			continue
+		}
+		fms = append(fms, fm)
+		then := fm.Then
+		if then == "" && cfg.Formatters != "all" {
+			then = "stop"
+		}
+		if then == "stop" {
+			debugf("%s: formatter %s: later formatters not tried", name, fm.Name)
+			break
+		}
+	}
+	return fms, nil
+}
+
+// formatterNamed returns the formatter named name, or nil.
+func (c *Config) formatterNamed(name string) *Formatter {
+	for _, fm := range c.Formatter {
+		if fm.Name == name {
+			return fm
+		}
+	}
+	return nil
+}
+
+// trackedFiles returns the absolute paths of the files under dir known
+// to git or, outside a git repository, every regular file not in a
+// hidden directory.
+func trackedFiles(dir string) ([]string, error) {
+	var files []string
+	cmd := exec.Command("git", "ls-files", "-z")
+	cmd.Dir = dir
+	if out, err := cmd.Output(); err == nil {
+		for _, f := range strings.Split(string(out), "\x00") {
+			if f != "" {
+				files = append(files, filepath.Join(dir, f))
+			}
+		}
+		return files, nil
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// windowDirty reports whether window id has unsaved changes.
+func windowDirty(id int) bool {
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return false
+	}
+	defer w.CloseFiles()
+	ctl, err := w.ReadAll("ctl")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(ctl))
+	return len(fields) > 4 && fields[4] == "1"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"time"
+)
+
+// A formatChain carries a file's contents through formatters that run
+// in turn on one put. Each formatter in apply mode is given the
+// previous ones' output, and the last applies the result to the window
+// at once. If the chain stops early, as when a formatter fails, what
+// the formatters before it did is applied instead.
+type formatChain struct {
+	// orig holds the contents as put, cur the contents formatted so far.
+	orig, cur []byte
+	last      *Formatter
+	// ran is the last formatter that changed cur.
+	ran *Formatter
+	// cfg is the config the formatters are from.
+	cfg *Config
+}
+
+// format runs fm, one of the formatters of c, on the file name open in
+// window id, with the timeout of the file's overrides if set.
+func (c *formatChain) format(id int, name string, fm *Formatter, timeout time.Duration) ([]byte, error) {
+	out, err := fm.outputTimeout(name, c.cur, timeout)
+	if err != nil {
+		if fm == c.last {
+			c.stop(id, name)
+		}
+		return out, err
+	}
+	compare(c.cfg, name, fm, c.cur, out)
+	unchanged := bytes.Equal(c.cur, out)
+	var diag []byte
+	onMain(func() {
+		if !unchanged {
+			switch {
+			case fm.Mode != "" && fm.Mode != "apply":
+				diag, err = showChanges(id, name, fm, c.cur, out)
+			case dryRun(fm):
+				wouldChange("dry-run", name, fm, c.cur, out)
+			default:
+				c.cur, c.ran = out, fm
+			}
+		}
+		if fm == c.last {
+			if aerr := c.apply(id, name); err == nil {
+				err = aerr
+			}
+		}
+	})
+	if err != nil {
+		return diag, err
+	}
+	if unchanged {
+		return nil, errUnchanged
+	}
+	return diag, nil
+}
+
+// apply applies the contents formatted so far to window id, showing
+// the file name, unless the window was edited meanwhile. It runs in
+// the main loop.
+func (c *formatChain) apply(id int, name string) error {
+	if bytes.Equal(c.orig, c.cur) {
+		return nil
+	}
+	if !bodyEquals(id, c.orig) {
+		return errWindowChanged
+	}
+	applyFormat(id, name, c.ran, c.orig, c.cur)
+	return nil
+}
+
+// stop applies what the chain's formatters have done so far, once it
+// stops before its last formatter applies it.
+func (c *formatChain) stop(id int, name string) {
+	onMain(func() {
+		if c.ran == nil {
+			return
+		}
+		e := Event{Event: "format", File: name, Rule: c.ran.Name, Outcome: "ok", Message: "chain stopped early; applied the formatters through this one"}
+		if err := c.apply(id, name); err != nil {
+			e.Outcome, e.Message = "skipped", "chain stopped early; "+err.Error()
+		}
+		emit(e)
+	})
+}
@@ -1,10 +1,15 @@
 module github.com/mjibson/acmewatch
 
-go 1.15
+go 1.18
 
 require (
 	9fans.net/go v0.0.3-0.20200508184858-c2124fe5805c
 	github.com/adrg/xdg v0.2.1
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/pelletier/go-toml v1.8.1
+)
+
+require (
 	github.com/stretchr/testify v1.6.1 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Guard configures the include_guard builtin formatter, which keeps a
+// C or C++ header's include guard in step with its path.
+type Guard struct {
+	// Style is "ifndef" (the default) for #ifndef guards or "pragma"
+	// for #pragma once.
+	Style string
+	// Root holds file names, like .git, marking the directory guard
+	// names are relative to. Defaults to .git.
+	Root []string
+	// Prefix is prepended to guard names.
+	Prefix string
+	// SortIncludes sorts each blank-line-separated group of #include
+	// lines.
+	SortIncludes bool `toml:"sort_includes"`
+}
+
+// includeGuard fixes or inserts the include guard of the header name,
+// whose contents are src.
+func includeGuard(ctx context.Context, fm *Formatter, name string, src []byte) ([]byte, error) {
+	g := fm.Guard
+	lines := splitLines(src)
+	if g.SortIncludes {
+		sortIncludes(lines)
+	}
+	start := skipComments(lines)
+	first := directive(lines, start)
+	switch {
+	case first == "#pragma once":
+	case g.Style == "pragma":
+		if guardName(lines, start) == "" {
+			lines = insertLines(lines, start, "#pragma once\n", "\n")
+		}
+	default:
+		want := guardMacro(name, g)
+		if old := guardName(lines, start); old != "" {
+			renameGuard(lines, start, old, want)
+		} else {
+			lines = insertLines(lines, start, "#ifndef "+want+"\n", "#define "+want+"\n", "\n")
+			lines = append(lines, "\n", "#endif // "+want+"\n")
+		}
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// guardMacro returns the guard macro for name: its path relative to
+// the project root, upper-cased, with other characters replaced by
+// underscores.
+func guardMacro(name string, g Guard) string {
+	markers := g.Root
+	if len(markers) == 0 {
+		markers = []string{".git"}
+	}
+	dir := filepath.Dir(name)
+	rel, err := filepath.Rel(projectRoot(dir, markers), name)
+	if err != nil {
+		rel = filepath.Base(name)
+	}
+	var b strings.Builder
+	b.WriteString(g.Prefix)
+	for _, r := range rel {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(unicode.ToUpper(r))
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	b.WriteByte('_')
+	return b.String()
+}
+
+// skipComments returns the index of the first line that is not blank or
+// part of a leading comment.
+func skipComments(lines []string) int {
+	inBlock := false
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		switch {
+		case inBlock:
+			inBlock = !strings.Contains(t, "*/")
+		case t == "" || strings.HasPrefix(t, "//"):
+		case strings.HasPrefix(t, "/*"):
+			inBlock = !strings.Contains(t[2:], "*/")
+		default:
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// directive returns the preprocessor directive on line i with its
+// spaces normalized, or "" if there is none.
+func directive(lines []string, i int) string {
+	if i >= len(lines) {
+		return ""
+	}
+	t := strings.TrimSpace(lines[i])
+	if !strings.HasPrefix(t, "#") {
+		return ""
+	}
+	f := strings.Fields(t[1:])
+	if len(f) == 0 {
+		return ""
+	}
+	return "#" + strings.Join(f, " ")
+}
+
+// guardName returns the macro of the #ifndef guard starting at line i,
+// or "" if there is none.
+func guardName(lines []string, i int) string {
+	f := strings.Fields(directive(lines, i))
+	if len(f) != 2 || f[0] != "#ifndef" {
+		return ""
+	}
+	d := strings.Fields(directive(lines, i+1))
+	if len(d) < 2 || d[0] != "#define" || d[1] != f[1] {
+		return ""
+	}
+	return f[1]
+}
+
+// renameGuard renames the guard at line i from old to new, along with
+// a trailing comment on the last #endif naming it.
+func renameGuard(lines []string, i int, old, new string) {
+	if old == new {
+		return
+	}
+	lines[i] = "#ifndef " + new + "\n"
+	lines[i+1] = strings.Replace(lines[i+1], old, new, 1)
+	for j := len(lines) - 1; j > i+1; j-- {
+		if strings.HasPrefix(directive(lines, j), "#endif") {
+			lines[j] = strings.Replace(lines[j], old, new, 1)
+			break
+		}
+	}
+}
+
+// insertLines returns lines with add inserted before line i.
+func insertLines(lines []string, i int, add ...string) []string {
+	out := make([]string, 0, len(lines)+len(add))
+	out = append(out, lines[:i]...)
+	out = append(out, add...)
+	return append(out, lines[i:]...)
+}
+
+// sortIncludes sorts, in place, each run of consecutive #include lines
+// by the file they include.
+func sortIncludes(lines []string) {
+	for i := 0; i < len(lines); {
+		j := i
+		for j < len(lines) && strings.HasPrefix(directive(lines, j), "#include ") {
+			j++
+		}
+		if j == i {
+			i++
+			continue
+		}
+		run := lines[i:j]
+		sort.SliceStable(run, func(a, b int) bool {
+			return includeKey(run[a]) < includeKey(run[b])
+		})
+		i = j
+	}
+}
+
+// includeKey returns the sort key of an #include line: system headers
+// (<...>) before local ones, then by name.
+func includeKey(line string) string {
+	f := strings.Fields(directive([]string{line}, 0))
+	if len(f) < 2 {
+		return line
+	}
+	file := strings.Join(f[1:], " ")
+	if strings.HasPrefix(file, "<") {
+		return "0" + file
+	}
+	return "1" + file
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIncludeGuard(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(root, "src", "foo-bar.h")
+	for _, tt := range []struct {
+		guard     Guard
+		src, want string
+	}{
+		{
+			Guard{}, "int f(void);\n",
+			"#ifndef SRC_FOO_BAR_H_\n#define SRC_FOO_BAR_H_\n\nint f(void);\n\n#endif // SRC_FOO_BAR_H_\n",
+		},
+		{
+			Guard{Prefix: "P_"}, "// Copyright.\n\nint f(void);\n",
+			"// Copyright.\n\n#ifndef P_SRC_FOO_BAR_H_\n#define P_SRC_FOO_BAR_H_\n\nint f(void);\n\n#endif // P_SRC_FOO_BAR_H_\n",
+		},
+		{
+			Guard{}, "#ifndef OLD_H\n#define OLD_H\nint f(void);\n#endif // OLD_H\n",
+			"#ifndef SRC_FOO_BAR_H_\n#define SRC_FOO_BAR_H_\nint f(void);\n#endif // SRC_FOO_BAR_H_\n",
+		},
+		{
+			Guard{}, "#ifndef SRC_FOO_BAR_H_\n#define SRC_FOO_BAR_H_\n#endif\n",
+			"#ifndef SRC_FOO_BAR_H_\n#define SRC_FOO_BAR_H_\n#endif\n",
+		},
+		{
+			Guard{}, "#pragma once\nint f(void);\n",
+			"#pragma once\nint f(void);\n",
+		},
+		{
+			Guard{Style: "pragma"}, "/* A\n * header.\n */\nint f(void);\n",
+			"/* A\n * header.\n */\n#pragma once\n\nint f(void);\n",
+		},
+		{
+			Guard{Style: "pragma"}, "#ifndef X_H\n#define X_H\n#endif\n",
+			"#ifndef X_H\n#define X_H\n#endif\n",
+		},
+		{
+			Guard{Style: "pragma", SortIncludes: true},
+			"#pragma once\n#include \"b.h\"\n#include <z.h>\n#include \"a.h\"\n\n#include <y.h>\n#include <x.h>\n",
+			"#pragma once\n#include <z.h>\n#include \"a.h\"\n#include \"b.h\"\n\n#include <x.h>\n#include <y.h>\n",
+		},
+	} {
+		fm := &Formatter{Guard: tt.guard}
+		got, err := includeGuard(context.Background(), fm, name, []byte(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("includeGuard(%+v, %q) = %q, want %q", tt.guard, tt.src, got, tt.want)
+		}
+	}
+}
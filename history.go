@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"9fans.net/go/acme"
+)
+
+// An applied is a formatting change applied to a window.
+type applied struct {
+	time     time.Time
+	rule     string
+	old, new []byte
+}
+
+// recordApplied adds to w's history the change rule made from old to
+// new, keeping the last config.History changes.
+func (w *window) recordApplied(rule string, old, new []byte) {
+	w.history = append(w.history, applied{time.Now(), rule, old, new})
+	if n := len(w.history) - config.History; n > 0 {
+		w.history = append(w.history[:0:0], w.history[n:]...)
+	}
+}
+
+// showLast is the showlast control command: showlast file. It shows the
+// formatting changes last applied to the windows on file, newest first,
+// in a window named file+Last.
+func showLast(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: showlast file")
+	}
+	name := args[0]
+	var b bytes.Buffer
+	for id, w := range windowState {
+		if w.name != name {
+			continue
+		}
+		for i := len(w.history) - 1; i >= 0; i-- {
+			a := w.history[i]
+			fmt.Fprintf(&b, "== %s %s (window %d)\n", a.time.Format("15:04:05"), a.rule, id)
+			b.Write(renderDiff(a.old, a.new, diff(a.old, a.new), config.PreviewContext))
+			b.WriteString("\n")
+		}
+	}
+	if b.Len() == 0 {
+		return "", fmt.Errorf("no formatting applied to %s", name)
+	}
+	lname := name + "+Last"
+	w := acme.Show(lname)
+	if w == nil {
+		var err error
+		if w, err = newWindow(lname); err != nil {
+			return "", err
+		}
+	}
+	w.Addr(",")
+	w.Write("data", b.Bytes())
+	w.Ctl("clean")
+	w.Addr("#0")
+	w.Ctl("dot=addr")
+	w.Ctl("show")
+	return "ok", nil
+}
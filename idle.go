@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"time"
+
+	"9fans.net/go/acme"
+)
+
+type idleWindow struct {
+	w       *acme.Win
+	sig     string
+	changed time.Time
+	fired   map[*Idle]bool
+	// running holds the rules running on the window, which are not
+	// started again until they finish.
+	running map[*Idle]bool
+}
+
+// idleWindows holds, by window id, the windows that match an idle rule.
+var idleWindows = map[int]*idleWindow{}
+
+// checkIdle polls the ctl file of every window matching an idle rule.
+// A window whose ctl state (body length, dirty flag) has not changed
+// for a rule's delay since its last change runs that rule once.
+func checkIdle() {
+	wins, err := acme.Windows()
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	seen := map[int]bool{}
+	for _, wi := range wins {
+		rules := idleRules(wi.Name)
+		if len(rules) == 0 {
+			continue
+		}
+		seen[wi.ID] = true
+		iw := idleWindows[wi.ID]
+		if iw == nil {
+			w, err := acme.Open(wi.ID, nil)
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			iw = &idleWindow{w: w, running: map[*Idle]bool{}}
+			idleWindows[wi.ID] = iw
+		}
+		ctl, err := iw.w.ReadAll("ctl")
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(ctl))
+		if len(fields) < 5 {
+			continue
+		}
+		sig := strings.Join(fields[1:5], " ")
+		if iw.sig == "" {
+			iw.sig = sig
+			continue
+		}
+		if sig != iw.sig {
+			iw.sig = sig
+			iw.changed = time.Now()
+			iw.fired = map[*Idle]bool{}
+			continue
+		}
+		if iw.fired == nil {
+			continue
+		}
+		for _, r := range rules {
+			if !iw.fired[r] && !iw.running[r] && time.Since(iw.changed) >= r.Delay {
+				iw.fired[r] = true
+				runIdle(iw, wi.Name, r)
+			}
+		}
+	}
+	for id, iw := range idleWindows {
+		if !seen[id] {
+			iw.w.CloseFiles()
+			delete(idleWindows, id)
+		}
+	}
+}
+
+func idleRules(name string) []*Idle {
+	cfg, err := configFor(name)
+	if err != nil {
+		return nil
+	}
+	var rules []*Idle
+	for _, r := range cfg.Idle {
+		if disabled[r.Name] {
+			continue
+		}
+		if matched, _ := r.matches(name); matched {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// runIdle runs r on the body of iw, showing the file name, in the
+// background, so a slow command does not hold up the main loop, and
+// emits the outcome.
+func runIdle(iw *idleWindow, name string, r *Idle) {
+	body, err := iw.w.ReadAll("body")
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	iw.running[r] = true
+	go func() {
+		idleRun(name, r, body)
+		mainFuncs <- func() { delete(iw.running, r) }
+	}()
+}
+
+// idleRun runs r on body, the contents of the file name.
+func idleRun(name string, r *Idle, body []byte) {
+	recordVersion(r.Name, &r.Command)
+	start := time.Now()
+	out, err := r.run(name, bytes.NewReader(body))
+	e := Event{
+		Time:        time.Now(),
+		Event:       "idle",
+		File:        name,
+		Rule:        r.Name,
+		Duration:    time.Since(start).Seconds(),
+		Outcome:     "ok",
+		Diagnostics: string(out),
+	}
+	if err != nil {
+		e.Outcome = "failed"
+		if len(out) == 0 {
+			e.Message = err.Error()
+		}
+	}
+	emit(e)
+	recordRun(e)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// fragmentDir returns the directory of config fragments merged into
+// the config file path: acmewatch.d next to acmewatch.toml.
+func fragmentDir(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".d"
+}
+
+// loadConfigTree reads the config file path, the files it includes and
+// the *.toml fragments in its fragment directory, in that order, and
+// merges them into one tree. It also returns the files read.
+func loadConfigTree(path string) (*toml.Tree, []string, error) {
+	l := &treeLoader{seen: map[string]bool{}}
+	tree, err := l.load(path)
+	if err != nil {
+		return nil, l.files, err
+	}
+	frags, err := filepath.Glob(filepath.Join(fragmentDir(path), "*.toml"))
+	if err != nil {
+		return nil, l.files, err
+	}
+	sort.Strings(frags)
+	for _, f := range frags {
+		t, err := l.load(f)
+		if err != nil {
+			return nil, l.files, err
+		}
+		mergeTree(tree, t)
+	}
+	return tree, l.files, nil
+}
+
+// A treeLoader loads config files and those they include, each once.
+type treeLoader struct {
+	seen  map[string]bool
+	files []string
+}
+
+// load reads the config file path and merges into it the files named
+// by its include key, which are relative to its directory and may be
+// globs. A file already loaded yields an empty tree.
+func (l *treeLoader) load(path string) (*toml.Tree, error) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if l.seen[path] {
+		return toml.TreeFromMap(nil)
+	}
+	l.seen[path] = true
+	l.files = append(l.files, path)
+	tree, err := toml.LoadFile(path)
+	if err != nil {
+		return nil, l.errorf(path, "%v", err)
+	}
+	v := tree.GetPath([]string{"include"})
+	if v == nil {
+		return tree, nil
+	}
+	tree.DeletePath([]string{"include"})
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, l.errorf(path, "include is not an array")
+	}
+	for _, item := range list {
+		pattern, ok := item.(string)
+		if !ok {
+			return nil, l.errorf(path, "include %v is not a string", item)
+		}
+		pattern = expandTilde(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		names, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, l.errorf(path, "include %q: %v", item, err)
+		}
+		if len(names) == 0 && !isGlob(pattern) {
+			if _, err := os.Stat(pattern); err != nil {
+				return nil, l.errorf(path, "include: %v", err)
+			}
+		}
+		for _, name := range names {
+			t, err := l.load(name)
+			if err != nil {
+				return nil, err
+			}
+			mergeTree(tree, t)
+		}
+	}
+	return tree, nil
+}
+
+// errorf returns an error in the config file path, naming it unless
+// it is the main config file, which callers name already.
+func (l *treeLoader) errorf(path, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	if path == l.files[0] {
+		return err
+	}
+	return fmt.Errorf("%s: %v", path, err)
+}
+
+// isGlob reports whether pattern has glob metacharacters.
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// mergeTree merges src into dst. Arrays, like the formatter and hook
+// tables, are appended to; tables are merged; other settings keep
+// dst's value.
+func mergeTree(dst, src *toml.Tree) {
+	for _, k := range src.Keys() {
+		key := []string{k}
+		sv := src.GetPath(key)
+		if !dst.HasPath(key) {
+			dst.SetPath(key, sv)
+			continue
+		}
+		switch dv := dst.GetPath(key).(type) {
+		case []*toml.Tree:
+			if s, ok := sv.([]*toml.Tree); ok {
+				dst.SetPath(key, append(dv, s...))
+			}
+		case []interface{}:
+			if s, ok := sv.([]interface{}); ok {
+				dst.SetPath(key, append(dv, s...))
+			}
+		case *toml.Tree:
+			if s, ok := sv.(*toml.Tree); ok {
+				mergeTree(dv, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pelletier/go-toml"
+)
+
+func TestMergeTree(t *testing.T) {
+	for _, tt := range []struct {
+		dst, src, want string
+	}{
+		{`a = 1`, `b = 2`, `a = 1
+b = 2
+`},
+		{`a = 1`, `a = 2`, `a = 1
+`},
+		{`match = ["*.go"]`, `match = ["*.c"]`, `match = ["*.go", "*.c"]
+`},
+		{`[t]
+a = 1`, `[t]
+a = 2
+b = 2`, `
+[t]
+  a = 1
+  b = 2
+`},
+		{`[[formatter]]
+name = "a"`, `[[formatter]]
+name = "b"`, `
+[[formatter]]
+  name = "a"
+
+[[formatter]]
+  name = "b"
+`},
+		{`t = 1`, `[t]
+a = 1`, `t = 1
+`},
+	} {
+		dst, err := toml.Load(tt.dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := toml.Load(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mergeTree(dst, src)
+		if got := dst.String(); got != tt.want {
+			t.Errorf("mergeTree(%q, %q) = %q, want %q", tt.dst, tt.src, got, tt.want)
+		}
+	}
+}
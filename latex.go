@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// latexindent formats a LaTeX file with latexindent.
+func latexindent(ctx context.Context, fm *Formatter, name string, src []byte) ([]byte, error) {
+	c := Command{Cmd: "latexindent", Args: []string{"-g", "/dev/null"}, Stdout: true}
+	return pipe(ctx, name, src, []Command{c})
+}
+
+var (
+	latexMu sync.Mutex
+	// latexBuilds records, by file, builds that are running. A true
+	// value means another put arrived meanwhile, so the build runs
+	// again once done.
+	latexBuilds = map[string]bool{}
+)
+
+// latexErrRe matches the file:line: errors latexmk prints with
+// -file-line-error.
+var latexErrRe = regexp.MustCompile(`^[^:\s]+\.(tex|sty|cls|bib):\d+: `)
+
+// latexmk builds the PDF of a LaTeX file with latexmk and returns its
+// errors. A put during a build does not start a second one; instead the
+// running build goes again when done, so a run of saves costs at most
+// two builds. If h.Plumb is set the PDF is plumbed once built.
+func latexmk(ctx context.Context, h *Hook, name string) ([]byte, error) {
+	latexMu.Lock()
+	if _, ok := latexBuilds[name]; ok {
+		latexBuilds[name] = true
+		latexMu.Unlock()
+		return []byte("build running; rebuilding when done\n"), nil
+	}
+	latexBuilds[name] = false
+	latexMu.Unlock()
+
+	c := Command{Cmd: "latexmk", Args: []string{"-pdf", "-interaction=nonstopmode", "-file-line-error", "-synctex=1", "$name"}}
+	for {
+		out, err := c.runContext(ctx, name, name, nil)
+		latexMu.Lock()
+		again := latexBuilds[name]
+		if !again {
+			delete(latexBuilds, name)
+		} else {
+			latexBuilds[name] = false
+		}
+		latexMu.Unlock()
+		if again {
+			continue
+		}
+		if err != nil {
+			var errs []string
+			for _, line := range strings.Split(string(out), "\n") {
+				if latexErrRe.MatchString(line) {
+					errs = append(errs, line)
+				}
+			}
+			if len(errs) > 0 {
+				out = []byte(strings.Join(errs, "\n") + "\n")
+			}
+			return out, err
+		}
+		if h.Plumb {
+			pdf := strings.TrimSuffix(name, filepath.Ext(name)) + ".pdf"
+			if out, err := exec.Command("9", "plumb", pdf).CombinedOutput(); err != nil {
+				return bytes.TrimSpace(out), err
+			}
+		}
+		return nil, nil
+	}
+}
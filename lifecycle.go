@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"os"
+)
+
+// lifecycle runs the hooks triggered by op, "new" or "del", for window
+// id, named name, which was just opened or closed.
+func lifecycle(id int, name, op string) error {
+	cfg, err := configFor(name)
+	if err != nil {
+		return err
+	}
+	var steps []*step
+	for _, h := range cfg.Hook {
+		if h.Trigger != op || disabled[h.Name] {
+			continue
+		}
+		matched, err := h.matches(name)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		h := h
+		steps = append(steps, &step{
+			kind:  "hook",
+			async: true,
+			cost:  hookCost(h),
+			name:  h.Name,
+			after: h.After,
+			chain: h.Chain,
+			cmd:   &h.Command,
+			run: func(ctx context.Context) ([]byte, error) {
+				if _, err := os.Stat(name); err != nil && h.Builtin == "" {
+					// A new window's file may not exist yet.
+					return h.runContext(ctx, name, name, nil)
+				}
+				return runHook(ctx, name, h)
+			},
+		})
+	}
+	if len(steps) == 0 {
+		return nil
+	}
+	return runSteps(id, name, steps)
+}
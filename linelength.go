@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+)
+
+// LineLength configures the line_length builtin hook.
+type LineLength struct {
+	// Width is the widest a line may be, in columns.
+	Width int
+	// TabWidth is the number of columns between tab stops. Defaults
+	// to 8.
+	TabWidth int `toml:"tab_width"`
+}
+
+// lineLength reports each line of name wider than the hook's width, as
+// file:line:col, where col is the first character past the limit.
+func lineLength(ctx context.Context, h *Hook, name string) ([]byte, error) {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	ll := h.LineLength
+	var out bytes.Buffer
+	n := 0
+	for i, line := range bytes.Split(src, []byte("\n")) {
+		width, over := 0, 0
+		for j, r := range []rune(string(line)) {
+			if r == '\t' {
+				width += ll.TabWidth - width%ll.TabWidth
+			} else {
+				width++
+			}
+			if width > ll.Width && over == 0 {
+				over = j + 1
+			}
+		}
+		if over > 0 {
+			n++
+			fmt.Fprintf(&out, "%s:%d:%d: line is %d columns, over %d\n", name, i+1, over, width, ll.Width)
+		}
+	}
+	if n > 0 {
+		return out.Bytes(), fmt.Errorf("%d lines over %d columns", n, ll.Width)
+	}
+	return nil, nil
+}
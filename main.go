@@ -10,205 +10,661 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strconv"
-	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"9fans.net/go/acme"
-	"github.com/adrg/xdg"
-	toml "github.com/pelletier/go-toml"
 )
 
+var (
+	auditFlag  = flag.Bool("audit", false, "verify window invariants after reformatting")
+	configFlag = flag.String("config", "", "read the config from `file` instead of $ACMEWATCH_CONFIG or acmewatch.toml in the XDG config directory")
+)
+
+var (
+	configPath string
+	// customConfig is set when configPath was given with -config or
+	// $ACMEWATCH_CONFIG.
+	customConfig bool
+	// config and lastMod, the modification time it was read at, are
+	// replaced only by the main loop, which holds configMu while doing
+	// so. Other goroutines must hold configMu to read them, as
+	// currentConfig does. A config is never modified once read.
+	config   = new(Config)
+	lastMod  time.Time
+	configMu sync.RWMutex
+)
+
+// mainFuncs carries functions to run in the main loop from other
+// goroutines.
+var mainFuncs = make(chan func())
+
 func main() {
-	flag.Parse()
-	l, err := acme.Log()
-	if err != nil {
-		log.Fatal(err)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acmewatch [flags]\n")
+		fmt.Fprintf(os.Stderr, "       acmewatch [flags] fmt-all [dir]\n")
+		fmt.Fprintf(os.Stderr, "       acmewatch ctl command [args...]\n")
+		fmt.Fprintf(os.Stderr, "       acmewatch stats [days]\n")
+		fmt.Fprintf(os.Stderr, "       acmewatch check [config...]\n")
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	configPath, err := xdg.ConfigFile("acmewatch.toml")
+	var err error
+	configPath, err = findConfig()
 	if err != nil {
 		log.Fatal(err)
 	}
-	var lastMod time.Time
-	var config Config
 
-	readEvent := func(id int, name string) error {
-		info, err := os.Stat(configPath)
-		if err != nil {
-			return err
-		}
-		mod := info.ModTime()
-		if mod.After(lastMod) {
-			f, err := os.Open(configPath)
-			if err != nil {
-				return err
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "fmt-all":
+			dir := "."
+			if flag.NArg() > 1 {
+				dir = flag.Arg(1)
 			}
-			defer f.Close()
-			if err := toml.NewDecoder(f).Decode(&config); err != nil {
-				return err
+			if err := fmtAll(dir); err != nil {
+				log.Fatal(err)
 			}
-			for _, fm := range config.Formatter {
-				for i, m := range fm.Match {
-					if strings.HasPrefix(m, ".") && !strings.Contains(m, "*") {
-						fm.Match[i] = "*" + m
-					}
+		case "stats":
+			days := 30
+			if flag.NArg() > 1 {
+				n, err := strconv.Atoi(flag.Arg(1))
+				if err != nil {
+					log.Fatalf("stats: bad days %q", flag.Arg(1))
 				}
+				days = n
+			}
+			if err := printStats(days); err != nil {
+				log.Fatal(err)
+			}
+		case "check":
+			paths := flag.Args()[1:]
+			if len(paths) == 0 {
+				paths = []string{configPath}
+			}
+			if !checkConfigs(paths) {
+				os.Exit(1)
 			}
-			lastMod = mod
-			fmt.Printf("read %s at %s\n", configPath, lastMod)
+		case "ctl":
+			if flag.NArg() < 2 {
+				flag.Usage()
+				os.Exit(2)
+			}
+			args := flag.Args()[1:]
+			if n, ok := fileArgs[args[0]]; ok && len(args) == n+1 && os.Getenv("%") != "" {
+				// Run from a window's tag, acme sets $% to its file.
+				args = append(args, os.Getenv("%"))
+			}
+			if len(args) == 1 && windowArgs[args[0]] && os.Getenv("winid") != "" {
+				args = append(args, os.Getenv("winid"))
+			}
+			if err := streamControl(os.Stdout, args...); err != nil {
+				log.Fatal(err)
+			}
+		default:
+			flag.Usage()
+			os.Exit(2)
 		}
+		return
+	}
 
-		for _, fm := range config.Formatter {
-			for _, m := range fm.Match {
-				matchName := name
-				if strings.HasPrefix(m, "*.") {
-					matchName = filepath.Base(matchName)
-				}
-				matched, err := filepath.Match(m, matchName)
-				if err != nil {
-					return err
-				}
-				if !matched {
-					continue
-				}
+	if _, err := listenControl(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadState(dumpPath("")); err != nil {
+		log.Print(err)
+	}
+	routeErrors = true
+	// Read the config before the first event, which it may put out of
+	// scope.
+	if err := readConfig(); err != nil {
+		emitError(configPath, err)
+	}
+	events := make(chan acme.LogEvent)
+	go readLog(events)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	configChanged := make(chan struct{}, 1)
+	if err := watchConfig(configChanged); err != nil {
+		debugf("watching config: %v; checking it on use", err)
+	} else {
+		configWatched, configDirty = true, true
+	}
+	tick := time.NewTicker(time.Second)
+	for {
+		select {
+		case event := <-events:
+			debugf("event %d %s %s", event.ID, event.Op, event.Name)
+			if event.Op == "focus" {
+				focused = event.ID
+			}
+			if event.Name != "" && !inScope(event.Name) {
+				continue
+			}
+			if deferBurst(event) {
+				continue
+			}
+			origin := "interactive"
+			if event.ID != focused {
+				origin = "script"
+			}
+			if debounce(event, origin) {
+				continue
+			}
+			dispatch(event, origin)
+		case id := <-burstDone:
+			if event, ok := endBurst(id); ok {
+				dispatch(event, "script")
+			}
+		case id := <-debounceDone:
+			if event, origin, ok := endDebounce(id); ok {
+				dispatch(event, origin)
+			}
+		case fn := <-mainFuncs:
+			fn()
+		case <-hup:
+			reloadConfig()
+		case <-configChanged:
+			configDirty = true
+			if err := readConfig(); err != nil {
+				emitError(configPath, err)
+			}
+		case req := <-ctlRequests:
+			runControl(req)
+		case <-tick.C:
+			if readConfig() == nil {
+				checkIdle()
+			}
+			refreshStatus()
+		}
+	}
+}
 
-				stdin := true
-				args := fm.Args
-				for i, arg := range args {
-					if arg == "$name" {
-						newArgs := make([]string, len(args))
-						copy(newArgs, args)
-						newArgs[i] = name
-						args = newArgs
-						stdin = false
-					}
-				}
-				cmd := exec.Command(fm.Cmd, args...)
-				cmd.Dir = filepath.Dir(name)
-				if stdin {
-					f, err := os.Open(name)
-					if err != nil {
-						return err
-					}
-					defer f.Close()
-					cmd.Stdin = f
-				}
-				out, err := cmd.CombinedOutput()
-				if err != nil {
-					return fmt.Errorf("%s: %s", err, string(out))
+// focused is the id of the window that last had focus.
+var focused int
+
+// handle handles an acme log event. Origin is "interactive" for a put
+// of the focused window and "script" for a put of another window or
+// one during a burst, as by Putall, Edit, or a program driving acme.
+func handle(event acme.LogEvent, origin string) {
+	switch event.Op {
+	case "del":
+		delete(windowState, event.ID)
+		if event.Name != "" && readConfig() == nil {
+			if err := lifecycle(event.ID, event.Name, "del"); err != nil {
+				emitError(event.Name, err)
+			}
+		}
+	case "focus":
+		if event.Name != "" && readConfig() == nil {
+			warm(event.Name)
+		}
+	case "new", "get":
+		if event.Name != "" && readConfig() == nil {
+			if err := filterGet(event.ID, event.Name); err != nil {
+				emitError(event.Name, err)
+			}
+			if event.Op == "new" {
+				if err := lifecycle(event.ID, event.Name, "new"); err != nil {
+					emitError(event.Name, err)
 				}
-				reformat(id, name, out)
-				return nil
 			}
 		}
+	}
+	if event.Name == "" || event.Op == "del" {
+		return
+	}
+	old := getWindow(event.ID).name
+	getWindow(event.ID).name = event.Name
+	restoreWindow(getWindow(event.ID))
+	if event.Op != "put" {
+		return
+	}
+	emit(Event{Event: "put", File: event.Name, Outcome: "ok"})
+	if old == event.Name {
+		old = ""
+	}
+	steps, err := putSteps(event.ID, event.Name, old, origin)
+	if err != nil {
+		emitError(event.Name, err)
+	}
+	saved := func() {
+		if err := filterPut(event.ID, event.Name); err != nil {
+			emitError(event.Name, err)
+		}
+		servePut(event.Name)
+		todoSaved(event.Name)
+		outlineSaved(event.Name)
+		completeSaved(event.Name)
+	}
+	if len(steps) == 0 {
+		saved()
+		return
+	}
+	// Run the rules in the background so puts of other windows need
+	// not wait, but hold this window's later events until they finish.
+	busyWindows[event.ID] = true
+	go func() {
+		err := runSteps(event.ID, event.Name, steps)
+		mainFuncs <- func() {
+			if err != nil {
+				emitError(event.Name, err)
+			}
+			saved()
+			windowIdle(event.ID)
+		}
+	}()
+}
 
-		return nil
+// putSteps returns the steps that run the rules for a put of window
+// id, named name. If the window was renamed by the put, oldName is its
+// previous name.
+func putSteps(id int, name, oldName, origin string) ([]*step, error) {
+	if err := readConfig(); err != nil {
+		return nil, err
 	}
 
-	for {
-		event, err := l.Read()
+	contents, err := windowBody(id)
+	if err != nil {
+		return nil, err
+	}
+	// The put of a window just formatted and put by acmewatch is not
+	// formatted again, but its hooks run, to see the formatted file.
+	autoput := isAutoput(id, contents)
+	changed := recordPut(id, contents)
+	cfg, err := configFor(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []*step
+	all, err := findFormatters(name)
+	if err != nil {
+		return nil, err
+	}
+	// The file's overrides are applied first, so the checks below
+	// that turn formatting off have the last word.
+	ov := fileOverrides(name, contents)
+	all = ov.formatters(name, cfg, all)
+	if autoput {
+		all = nil
+	}
+	if why := formatOff(name); why != "" && len(all) > 0 {
+		emit(Event{Event: "format", File: name, Outcome: "skipped", Message: "formatting off: " + why})
+		all = nil
+	}
+	if line := conflictLine(contents); line > 0 && len(all) > 0 {
+		emit(Event{Event: "format", File: name, Outcome: "skipped", Message: fmt.Sprintf("unresolved conflict at line %d; not formatting", line)})
+		all = nil
+	}
+	var fms []*Formatter
+	for _, fm := range all {
+		switch {
+		case fm.Trigger == "changed" && !changed:
+			debugf("%s: formatter %s: not run, contents unchanged since the last put", name, fm.Name)
+		case !originOK(fm.Origin, origin):
+			debugf("%s: formatter %s: not run for %s puts", name, fm.Name, origin)
+		default:
+			fms = append(fms, fm)
+		}
+	}
+	if len(fms) == 1 {
+		fm := fms[0]
+		steps = append(steps, &step{
+			kind:          "format",
+			name:          fm.Name,
+			after:         fm.After,
+			skipUnchanged: fm.SkipUnchanged,
+			noop:          getWindow(id).isFormatted(fm, contents),
+			chain:         fm.Chain,
+			cmd:           &fm.Command,
+			run:           func(context.Context) ([]byte, error) { return format(id, name, cfg, fm, ov.timeout) },
+		})
+	} else if len(fms) > 1 {
+		fc := &formatChain{orig: contents, cur: contents, last: fms[len(fms)-1], cfg: cfg}
+		for i, fm := range fms {
+			fm := fm
+			after := fm.After
+			if i > 0 {
+				after = append(after[:len(after):len(after)], fms[i-1].Name)
+			}
+			s := &step{
+				kind:  "format",
+				name:  fm.Name,
+				after: after,
+				chain: fm.Chain,
+				cmd:   &fm.Command,
+				run:   func(context.Context) ([]byte, error) { return fc.format(id, name, fm, ov.timeout) },
+			}
+			if fm == fc.last {
+				// The chain stopped short of the step that applies it.
+				s.skipped = func() { fc.stop(id, name) }
+			}
+			steps = append(steps, s)
+		}
+	}
+	for _, h := range cfg.Hook {
+		if disabled[h.Name] {
+			debugf("%s: hook %s: disabled", name, h.Name)
+			continue
+		}
+		matched, err := h.matches(name)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
+		}
+		if debugFlag && h.Trigger != "new" && h.Trigger != "del" {
+			why := h.why(name)
+			switch {
+			case !matched:
+			case h.Trigger == "changed" && !changed:
+				why += ", but contents unchanged since the last put"
+			case !originOK(h.Origin, origin):
+				why += fmt.Sprintf(", but not run for %s puts", origin)
+			}
+			debugf("%s: hook %s: %s", name, h.Name, why)
 		}
-		if event.Name == "" || event.Op != "put" {
+		if !matched || (h.Trigger == "changed" && !changed) || h.Trigger == "new" || h.Trigger == "del" || !originOK(h.Origin, origin) {
 			continue
 		}
-		if err := readEvent(event.ID, event.Name); err != nil {
-			fmt.Printf("%s: %s\n", event.Name, err)
+		h := ov.hook(h)
+		if h == nil {
+			continue
+		}
+		steps = append(steps, &step{
+			kind:          "hook",
+			async:         true,
+			cost:          hookCost(h),
+			name:          h.Name,
+			after:         h.After,
+			skipUnchanged: h.SkipUnchanged,
+			chain:         h.Chain,
+			cmd:           &h.Command,
+			run: func(ctx context.Context) ([]byte, error) {
+				out, err := runHook(ctx, name, h)
+				if h.toErrors && ctx.Err() == nil && errorsDir(name) == "" && !observing() {
+					go func() {
+						mainFuncs <- func() {
+							if err := showErrors(filepath.Dir(name), out); err != nil {
+								log.Print(err)
+							}
+						}
+					}()
+				}
+				return out, err
+			},
+		})
+	}
+
+	if oldName != "" {
+		for _, h := range cfg.Rename {
+			if disabled[h.Name] {
+				continue
+			}
+			matched, err := h.matches(name)
+			if err != nil {
+				return nil, err
+			}
+			oh := ov.hook(h)
+			if !matched || oh == nil {
+				continue
+			}
+			rh := *oh
+			rh.Args = replaceArg(h.Args, "$old", oldName)
+			steps = append(steps, &step{
+				kind:  "rename",
+				async: true,
+				cost:  hookCost(h),
+				name:  h.Name,
+				after: h.After,
+				chain: h.Chain,
+				cmd:   &rh.Command,
+				run:   func(ctx context.Context) ([]byte, error) { return runHook(ctx, name, &rh) },
+			})
+		}
+	}
+
+	return steps, nil
+}
+
+// format runs fm, from cfg, on the body of window id, showing the file
+// name, and applies its output to the window. A timeout, if set,
+// replaces fm's own. On failure it returns the formatter's output as
+// diagnostics. It returns errUnchanged if the file was already
+// formatted.
+func format(id int, name string, cfg *Config, fm *Formatter, timeout time.Duration) ([]byte, error) {
+	old, err := windowBody(id)
+	if err != nil {
+		return nil, err
+	}
+	out, err := fm.outputTimeout(name, old, timeout)
+	if err != nil {
+		return out, err
+	}
+	compare(cfg, name, fm, old, out)
+	var diag []byte
+	onMain(func() {
+		switch {
+		case bytes.Equal(old, out):
+			getWindow(id).setFormatted(fm, old)
+			err = errUnchanged
+		case fm.Mode != "" && fm.Mode != "apply":
+			diag, err = showChanges(id, name, fm, old, out)
+		case dryRun(fm):
+			wouldChange("dry-run", name, fm, old, out)
+		case !bodyEquals(id, old):
+			// Edits made while fm ran would be reverted.
+			err = errWindowChanged
+		default:
+			applyFormat(id, name, fm, old, out)
+		}
+	})
+	return diag, err
+}
+
+// showChanges shows or reports the changes fm would make to the file
+// name, turning old into new, as fm's mode asks.
+func showChanges(id int, name string, fm *Formatter, old, new []byte) ([]byte, error) {
+	switch {
+	case fm.Mode == "check":
+	case observing():
+		wouldChange("observe", name, fm, old, new)
+		return nil, nil
+	case dryRun(fm):
+		wouldChange("dry-run", name, fm, old, new)
+		return nil, nil
+	}
+	hunks := diff(old, new)
+	switch fm.Mode {
+	case "check":
+		return checkReport(name, old, new, hunks), errors.New("not formatted")
+	case "edit":
+		showEditScript(name, old, new, hunks)
+	default:
+		showPreview(id, name, old, new, hunks)
+	}
+	return nil, nil
+}
+
+// applyFormat applies new, fm's output for the file name, to window id
+// and to other windows on the file showing old.
+func applyFormat(id int, name string, fm *Formatter, old, new []byte) {
+	if observing() {
+		wouldChange("observe", name, fm, old, new)
+		return
+	}
+	getWindow(id).setFormatted(fm, new)
+	getWindow(id).recordApplied(fm.Name, old, new)
+	reformat(id, name, new)
+	var same []int
+	for _, wi := range aliases(id, name) {
+		// The formatter ran once; apply its output to other windows
+		// on the same file if they show what was formatted.
+		if bodyEquals(wi.ID, old) {
+			reformat(wi.ID, wi.Name, new)
+			getWindow(wi.ID).setFormatted(fm, new)
+			same = append(same, wi.ID)
 		}
 	}
+	if autoput(name, fm) {
+		putWindow(id, new, same)
+	}
 }
 
-type Config struct {
-	Formatter []struct {
-		Match []string
-		Cmd   string
-		Args  []string
+// autoput reports whether windows on name formatted by fm are put
+// afterward.
+func autoput(name string, fm *Formatter) bool {
+	if fm.Autoput != nil {
+		return *fm.Autoput
 	}
+	cfg, err := configFor(name)
+	return err == nil && cfg.Autoput
 }
 
-func reformat(id int, name string, new []byte) {
+// putWindow puts window id, whose body is now contents, and marks the
+// windows in same, which show the same contents, clean. The put event
+// that follows is not formatted again.
+func putWindow(id int, contents []byte, same []int) {
 	w, err := acme.Open(id, nil)
 	if err != nil {
 		log.Print(err)
 		return
 	}
 	defer w.CloseFiles()
+	sum := sha256.Sum256(contents)
+	getWindow(id).autoputSum = &sum
+	if err := w.Ctl("put"); err != nil {
+		getWindow(id).autoputSum = nil
+		log.Print(err)
+		return
+	}
+	for _, other := range same {
+		if w, err := acme.Open(other, nil); err == nil {
+			w.Ctl("clean")
+			w.CloseFiles()
+		}
+	}
+}
 
-	old, err := ioutil.ReadFile(name)
+// isAutoput reports whether the put of window id, whose body is
+// contents, was made by putWindow, clearing the record of it.
+func isAutoput(id int, contents []byte) bool {
+	w := getWindow(id)
+	if w.autoputSum == nil {
+		return false
+	}
+	sum := *w.autoputSum
+	w.autoputSum = nil
+	return sum == sha256.Sum256(contents)
+}
+
+// runHook runs h on the file name and returns its output as
+// diagnostics. The hook is killed if ctx is done first.
+func runHook(ctx context.Context, name string, h *Hook) ([]byte, error) {
+	if h.Builtin != "" {
+		return hookBuiltins[h.Builtin](ctx, h, name)
+	}
+	f, err := os.Open(name)
 	if err != nil {
-		//log.Print(err)
-		return
+		return nil, err
 	}
+	defer f.Close()
+	return h.runContext(ctx, name, name, f)
+}
 
-	if new == nil || bytes.Equal(old, new) {
+func reformat(id int, name string, new []byte) {
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		log.Print(err)
 		return
 	}
+	defer w.CloseFiles()
 
-	f, err := ioutil.TempFile("", "acmego")
+	old, err := w.ReadAll("body")
 	if err != nil {
 		log.Print(err)
 		return
 	}
-	if _, err := f.Write(new); err != nil {
-		log.Print(err)
+
+	if new == nil || bytes.Equal(old, new) {
 		return
 	}
-	tmp := f.Name()
-	f.Close()
-	defer os.Remove(tmp)
 
-	diff, _ := exec.Command("9", "diff", name, tmp).CombinedOutput()
+	hunks := diff(old, new)
+	// Keep the selection on the text it was on. acme itself keeps the
+	// visible region in place as lines above it change.
+	var q0, q1 int
+	dotErr := w.Ctl("addr=dot")
+	if dotErr == nil {
+		q0, q1, dotErr = w.ReadAddr()
+	}
 
-	w.Write("ctl", []byte("mark"))
-	w.Write("ctl", []byte("nomark"))
-	diffLines := strings.Split(string(diff), "\n")
-	for i := len(diffLines) - 1; i >= 0; i-- {
-		line := diffLines[i]
-		if line == "" {
-			continue
-		}
-		if line[0] == '<' || line[0] == '-' || line[0] == '>' {
-			continue
-		}
-		j := 0
-		for j < len(line) && line[j] != 'a' && line[j] != 'c' && line[j] != 'd' {
-			j++
-		}
-		if j >= len(line) {
-			log.Printf("cannot parse diff line: %q", line)
-			break
+	applyHunks(w, new, hunks, config.Undo)
+
+	if dotErr == nil {
+		q0, q1 = mapOffset(old, new, hunks, q0), mapOffset(old, new, hunks, q1)
+		if err := w.Addr("#%d,#%d", q0, q1); err == nil {
+			w.Ctl("dot=addr")
 		}
-		oldStart, oldEnd := parseSpan(line[:j])
-		newStart, newEnd := parseSpan(line[j+1:])
-		if oldStart == 0 || newStart == 0 {
-			continue
+	}
+
+	if *auditFlag {
+		audit(w, name, old, new)
+	}
+}
+
+// editor is the part of an acme window that applyHunks edits through,
+// so that tests can stand in a fake window.
+type editor interface {
+	Addr(format string, args ...interface{}) error
+	Write(file string, b []byte) (int, error)
+}
+
+// applyHunks edits w, holding the old text, into new by applying hunks
+// from last to first, with undo marks as for the undo setting.
+func applyHunks(w editor, new []byte, hunks []hunk, undo string) {
+	switch undo {
+	case "nomark":
+		w.Write("ctl", []byte("nomark"))
+	case "hunk":
+	default:
+		w.Write("ctl", []byte("mark"))
+		w.Write("ctl", []byte("nomark"))
+	}
+	for i := len(hunks) - 1; i >= 0; i-- {
+		h := hunks[i]
+		if undo == "hunk" {
+			w.Write("ctl", []byte("mark"))
+			w.Write("ctl", []byte("nomark"))
 		}
-		switch line[j] {
+		switch h.op {
 		case 'a':
-			err := w.Addr("%d+#0", oldStart)
+			err := w.Addr("%d+#0", h.oldStart)
 			if err != nil {
 				log.Print(err)
 				break
 			}
-			w.Write("data", findLines(new, newStart, newEnd))
+			w.Write("data", findLines(new, h.newStart, h.newEnd))
 		case 'c':
-			err := w.Addr("%d,%d", oldStart, oldEnd)
+			err := w.Addr("%d,%d", h.oldStart, h.oldEnd)
 			if err != nil {
 				log.Print(err)
 				break
 			}
-			w.Write("data", findLines(new, newStart, newEnd))
+			w.Write("data", findLines(new, h.newStart, h.newEnd))
 		case 'd':
-			err := w.Addr("%d,%d", oldStart, oldEnd)
+			err := w.Addr("%d,%d", h.oldStart, h.oldEnd)
 			if err != nil {
 				log.Print(err)
 				break
@@ -218,23 +674,15 @@ func reformat(id int, name string, new []byte) {
 	}
 }
 
-func parseSpan(text string) (start, end int) {
-	i := strings.Index(text, ",")
-	if i < 0 {
-		n, err := strconv.Atoi(text)
-		if err != nil {
-			log.Printf("cannot parse span %q", text)
-			return 0, 0
-		}
-		return n, n
-	}
-	start, err1 := strconv.Atoi(text[:i])
-	end, err2 := strconv.Atoi(text[i+1:])
-	if err1 != nil || err2 != nil {
-		log.Printf("cannot parse span %q", text)
-		return 0, 0
-	}
-	return start, end
+// A hunk is one change of an ed-style diff. For 'c' and 'd', lines
+// oldStart through oldEnd of the old text are replaced or deleted; for
+// 'a', new lines are added after line oldStart. Lines newStart through
+// newEnd of the new text are the replacement ('d' names the line
+// after which the deletion happens).
+type hunk struct {
+	op               byte
+	oldStart, oldEnd int
+	newStart, newEnd int
 }
 
 func findLines(text []byte, start, end int) []byte {
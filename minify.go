@@ -0,0 +1,39 @@
+package main
+
+import "fmt"
+
+// minifyTools holds, by language, the commands that prettify and
+// minify it.
+var minifyTools = map[string][2]Command{
+	"js": {
+		{Cmd: "prettier", Args: []string{"--parser", "babel"}, Stdout: true},
+		{Cmd: "esbuild", Args: []string{"--minify", "--loader=js"}, Stdout: true},
+	},
+	"css": {
+		{Cmd: "prettier", Args: []string{"--parser", "css"}, Stdout: true},
+		{Cmd: "esbuild", Args: []string{"--minify", "--loader=css"}, Stdout: true},
+	},
+	"json": {
+		{Cmd: "jq", Args: []string{"."}, Stdout: true},
+		{Cmd: "jq", Args: []string{"-c", "."}, Stdout: true},
+	},
+}
+
+// setMinified fills in the get and put commands of a filter for
+// minified files that are not already set.
+func (f *Filter) setMinified() error {
+	if f.Minified == "" {
+		return nil
+	}
+	tools, ok := minifyTools[f.Minified]
+	if !ok {
+		return fmt.Errorf("unknown minified %q", f.Minified)
+	}
+	if f.Get.Cmd == "" {
+		f.Get = tools[0]
+	}
+	if f.Put.Cmd == "" && !f.KeepPretty {
+		f.Put = tools[1]
+	}
+	return nil
+}
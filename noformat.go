@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// disableName is the sentinel file that turns formatting off in the
+// directory holding it and below, as during a large rebase or merge.
+const disableName = ".acmewatch-disable"
+
+// formatOff returns why formatting of the file name is turned off, by
+// $NOFORMAT or a sentinel file above it, or "" if it is not. The
+// sentinel is looked for on every put, so removing it turns
+// formatting back on.
+func formatOff(name string) string {
+	if os.Getenv("NOFORMAT") != "" {
+		return "NOFORMAT is set"
+	}
+	root := projectRoot(filepath.Dir(name), []string{disableName})
+	sentinel := filepath.Join(root, disableName)
+	if _, err := os.Stat(sentinel); err == nil {
+		return sentinel + " exists"
+	}
+	return ""
+}
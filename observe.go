@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var dryRunFlag = flag.Bool("dry-run", false, "report the changes formatters would make, as diffs, instead of making them")
+
+// observing reports whether the config sets observe mode, in which
+// every rule runs but no window or file is changed; what formatters
+// would have changed is reported instead.
+func observing() bool {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config.Observe
+}
+
+// dryRun reports whether fm only reports its changes, by -dry-run or
+// its dry_run setting.
+func dryRun(fm *Formatter) bool {
+	return *dryRunFlag || fm.DryRun
+}
+
+// wouldChange reports, as an event of kind event, the change fm would
+// have made to the file name, from old to new.
+func wouldChange(event, name string, fm *Formatter, old, new []byte) {
+	hunks := diff(old, new)
+	configMu.RLock()
+	context := config.PreviewContext
+	configMu.RUnlock()
+	emit(Event{
+		Event:       event,
+		File:        name,
+		Rule:        fm.Name,
+		Outcome:     "would_change",
+		Message:     fmt.Sprintf("would make %d changes", len(hunks)),
+		Diagnostics: string(renderDiff(old, new, hunks, context)),
+	})
+}
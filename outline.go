@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// An Outline lists the symbols of matching files in a file+Outline
+// window.
+type Outline struct {
+	Matcher
+	// Command prints the file's symbols. It defaults to universal
+	// ctags.
+	Command
+	// Format is how the command prints symbols: "ctags" (the default)
+	// for tags lines, "gopls" for the output of gopls symbols, or
+	// "plain" for lines shown as they are.
+	Format string
+}
+
+// outlineWindows holds the open outline windows by file name. It is
+// used only by the main loop.
+var outlineWindows = map[string]*acme.Win{}
+
+// check validates o and fills in its defaults.
+func (o *Outline) check() error {
+	switch o.Format {
+	case "", "ctags", "gopls", "plain":
+	default:
+		return fmt.Errorf("outline: unknown format %q", o.Format)
+	}
+	if o.Cmd == "" && (o.Format == "" || o.Format == "ctags") {
+		o.Command = Command{Cmd: "ctags", Args: []string{"-f", "-", "--fields=+nK", "$name"}, Stdout: true}
+	}
+	o.expand()
+	return o.compileMatch()
+}
+
+// openOutline is the outline control command. It opens, or refreshes,
+// the outline window of a file.
+func openOutline(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: outline file")
+	}
+	name := args[0]
+	if outlineFor(name) == nil {
+		return "", fmt.Errorf("no outline rule matches %s", name)
+	}
+	if outlineWindows[name] == nil {
+		w, err := newWindow(name + "+Outline")
+		if err != nil {
+			return "", err
+		}
+		w.Write("tag", []byte(" Get"))
+		outlineWindows[name] = w
+		go outlineEvents(name, w)
+	}
+	refreshOutline(name)
+	return "ok", nil
+}
+
+// outlineFor returns the outline rule matching name, or nil.
+func outlineFor(name string) *Outline {
+	cfg, err := configFor(name)
+	if err != nil {
+		return nil
+	}
+	for _, o := range cfg.Outline {
+		if matched, _ := o.matches(name); matched {
+			return o
+		}
+	}
+	return nil
+}
+
+// outlineSaved refreshes the outline window of the saved file name, if
+// open.
+func outlineSaved(name string) {
+	if outlineWindows[name] != nil {
+		refreshOutline(name)
+	}
+}
+
+// refreshOutline reruns the outline of name in the background and
+// rewrites its window.
+func refreshOutline(name string) {
+	o := outlineFor(name)
+	if o == nil {
+		return
+	}
+	go func() {
+		out, err := o.run(name, nil)
+		if err == nil {
+			out = o.render(name, out)
+		}
+		mainFuncs <- func() {
+			w := outlineWindows[name]
+			if w == nil {
+				return
+			}
+			if err != nil {
+				emitError(name, fmt.Errorf("outline: %v\n%s", err, out))
+				return
+			}
+			w.Addr(",")
+			w.Write("data", out)
+			w.Ctl("clean")
+			w.Addr("#0")
+			w.Ctl("dot=addr")
+			w.Ctl("show")
+		}
+	}()
+}
+
+// render turns the output of o's command for name into outline lines,
+// each beginning with an address in the window's directory.
+func (o *Outline) render(name string, out []byte) []byte {
+	if o.Format == "plain" {
+		return out
+	}
+	base := filepath.Base(name)
+	var b bytes.Buffer
+	for _, l := range strings.Split(string(out), "\n") {
+		var sym, kind string
+		line := 0
+		switch o.Format {
+		case "gopls":
+			// Foo Function 3:6-3:9
+			f := strings.Fields(l)
+			if len(f) < 3 {
+				continue
+			}
+			sym, kind = f[0], strings.ToLower(f[1])
+			pos := f[len(f)-1]
+			if i := strings.Index(pos, ":"); i > 0 {
+				line, _ = strconv.Atoi(pos[:i])
+			}
+		default:
+			if l == "" || strings.HasPrefix(l, "!_") {
+				continue
+			}
+			// name, file, address, then fields; other lines, like a
+			// warning in the output, are not tags.
+			f := strings.Split(l, "\t")
+			if len(f) < 3 {
+				continue
+			}
+			sym = f[0]
+			for _, field := range f[3:] {
+				switch {
+				case strings.HasPrefix(field, "line:"):
+					line, _ = strconv.Atoi(field[len("line:"):])
+				case strings.HasPrefix(field, "kind:"):
+					kind = field[len("kind:"):]
+				case !strings.Contains(field, ":"):
+					kind = field
+				}
+			}
+		}
+		if line > 0 {
+			fmt.Fprintf(&b, "%s:%d\t%s %s\n", base, line, kind, sym)
+		}
+	}
+	return b.Bytes()
+}
+
+// outlineEvents handles the events of the outline window of name. Get
+// reruns the outline.
+func outlineEvents(name string, w *acme.Win) {
+	for e := range w.EventChan() {
+		if (e.C2 == 'x' || e.C2 == 'X') && string(e.Text) == "Get" {
+			mainFuncs <- func() { refreshOutline(name) }
+			continue
+		}
+		w.WriteEvent(e)
+	}
+	mainFuncs <- func() { delete(outlineWindows, name) }
+}
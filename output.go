@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var jsonFlag = flag.Bool("json", false, "print status and diagnostics as JSON lines")
+
+// An Event is one line of status or diagnostic output.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	File  string    `json:"file,omitempty"`
+	Rule  string    `json:"rule,omitempty"`
+	// Duration is in seconds.
+	Duration    float64 `json:"duration,omitempty"`
+	Outcome     string  `json:"outcome,omitempty"`
+	Message     string  `json:"message,omitempty"`
+	Diagnostics string  `json:"diagnostics,omitempty"`
+}
+
+var outputMu sync.Mutex
+
+// emit prints e and sends it to subscribers. In text mode events with
+// neither a message nor diagnostics are not printed.
+func emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Message = validUTF8(e.Message)
+	configMu.RLock()
+	style, sv := config.Address, config.Severity
+	configMu.RUnlock()
+	e.Diagnostics = markSeverity(sv, rewriteAddresses(style, e.File, validUTF8(e.Diagnostics)))
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if eventBus.active() {
+		b, _ := json.Marshal(e)
+		eventBus.send(append(b, '\n'))
+	}
+	text := e.text()
+	if text != "" && e.File != "" {
+		lastOutput[e.File] = text
+	}
+	if *jsonFlag {
+		json.NewEncoder(os.Stdout).Encode(e)
+		return
+	}
+	if text == "" {
+		return
+	}
+	if dir := errorsDir(e.File); dir != "" && (e.Outcome == "failed" || e.Diagnostics != "") {
+		if err := showErrors(dir, []byte(text)); err == nil {
+			return
+		}
+	}
+	fmt.Println(text)
+}
+
+// text returns e as text: a line with the time, file, rule, message,
+// and duration, followed by any multi-line diagnostics. It is empty if
+// e has neither a message nor diagnostics.
+func (e Event) text() string {
+	msg := e.Message
+	diag := strings.TrimRight(e.Diagnostics, "\n")
+	if msg == "" && !strings.Contains(diag, "\n") {
+		msg, diag = diag, ""
+	}
+	if msg == "" && diag == "" {
+		return ""
+	}
+	if msg == "" {
+		msg = "output"
+	}
+	if e.Duration > 0 {
+		d := time.Duration(e.Duration * float64(time.Second))
+		msg += fmt.Sprintf(" (%s)", d.Round(time.Millisecond))
+	}
+	if e.Rule != "" {
+		msg = e.Rule + ": " + msg
+	}
+	if e.File != "" {
+		msg = e.File + ": " + msg
+	}
+	msg = e.Time.Format("15:04:05") + " " + msg
+	if diag != "" {
+		msg += "\n" + diag
+	}
+	return msg
+}
+
+// emitError reports err for file.
+func emitError(file string, err error) {
+	emit(Event{Event: "error", File: file, Outcome: "failed", Message: err.Error()})
+}
+
+// validUTF8 replaces invalid UTF-8 in tool output, such as messages in
+// a legacy locale encoding, with U+FFFD so that it displays the same
+// everywhere instead of as mojibake.
+func validUTF8(s string) string {
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var overrideRe = regexp.MustCompile(`\bacmewatch:(.*)`)
+
+// overrides are per-file settings read from an acmewatch: comment in
+// the first or last five lines of a file, like
+//
+//	# acmewatch: formatter=black timeout=10s
+type overrides struct {
+	// formatter names the only formatter run on the file, or is
+	// "none" to run none.
+	formatter string
+	// disable holds rules not run on the file.
+	disable map[string]bool
+	// timeout replaces the timeout of every rule run on the file.
+	timeout time.Duration
+}
+
+// fileOverrides returns the overrides in src, the contents of the file
+// name. Options it cannot parse are reported and ignored.
+func fileOverrides(name string, src []byte) overrides {
+	var ov overrides
+	lines := bytes.Split(src, []byte("\n"))
+	if n := len(lines); n > 10 {
+		lines = append(lines[:5:5], lines[n-5:]...)
+	}
+	for _, l := range lines {
+		m := overrideRe.FindSubmatch(l)
+		if m == nil {
+			continue
+		}
+		for _, f := range strings.Fields(string(m[1])) {
+			i := strings.Index(f, "=")
+			if i < 0 {
+				// Comment closers like */ or -->.
+				continue
+			}
+			if err := ov.set(f[:i], f[i+1:]); err != nil {
+				emitError(name, fmt.Errorf("acmewatch: %s: %v", f, err))
+			}
+		}
+		debugf("%s: overrides %s", name, bytes.TrimSpace(m[1]))
+	}
+	return ov
+}
+
+func (ov *overrides) set(key, value string) error {
+	switch key {
+	case "formatter":
+		ov.formatter = value
+	case "disable":
+		if ov.disable == nil {
+			ov.disable = make(map[string]bool)
+		}
+		for _, r := range strings.Split(value, ",") {
+			ov.disable[r] = true
+		}
+	case "timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		ov.timeout = d
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// formatters returns the formatters of cfg run on the file, starting
+// from all, those its rules select.
+func (ov *overrides) formatters(name string, cfg *Config, all []*Formatter) []*Formatter {
+	switch ov.formatter {
+	case "":
+	case "none":
+		return nil
+	default:
+		fm := cfg.formatterNamed(ov.formatter)
+		if fm == nil {
+			emitError(name, fmt.Errorf("acmewatch: unknown formatter %q", ov.formatter))
+			break
+		}
+		all = []*Formatter{fm}
+	}
+	var fms []*Formatter
+	for _, fm := range all {
+		if !ov.disable[fm.Name] {
+			fms = append(fms, fm)
+		}
+	}
+	return fms
+}
+
+// hook returns h as run on the file, or nil if the file disables it.
+func (ov *overrides) hook(h *Hook) *Hook {
+	if ov.disable[h.Name] {
+		return nil
+	}
+	if ov.timeout > 0 {
+		c := *h
+		c.Timeout = ov.timeout
+		h = &c
+	}
+	return h
+}
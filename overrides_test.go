@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileOverrides(t *testing.T) {
+	middle := strings.Repeat("x\n", 5) + "# acmewatch: formatter=none\n" + strings.Repeat("x\n", 5)
+	for _, tt := range []struct {
+		src  string
+		want overrides
+	}{
+		{"package main\n", overrides{}},
+		{"# acmewatch: formatter=black timeout=10s\nimport os\n", overrides{formatter: "black", timeout: 10 * time.Second}},
+		{"/* acmewatch: disable=gofmt,vet */\n", overrides{disable: map[string]bool{"gofmt": true, "vet": true}}},
+		{"<!-- acmewatch: formatter=none -->\n", overrides{formatter: "none"}},
+		{middle, overrides{}},
+		{middle + "// acmewatch: timeout=1m\n", overrides{timeout: time.Minute}},
+		{"# acmewatch: formatter=a\n# acmewatch: formatter=b\n", overrides{formatter: "b"}},
+	} {
+		if got := fileOverrides("/src/a", []byte(tt.src)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("fileOverrides(%q) = %+v, want %+v", tt.src, got, tt.want)
+		}
+	}
+}
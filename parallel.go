@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// toolSlots tracks the running and waiting commands of a tool limited
+// by the parallel config.
+type toolSlots struct {
+	running int
+	// waiting holds, first come first served, a channel per waiting
+	// command, closed when it is handed a slot.
+	waiting []chan struct{}
+}
+
+var (
+	toolsMu sync.Mutex
+	tools   = map[string]*toolSlots{}
+)
+
+// acquireTool blocks until a command of tool may run under the
+// parallel config, or ctx is done. The returned function gives the
+// slot up.
+func acquireTool(ctx context.Context, tool string) (func(), error) {
+	configMu.RLock()
+	max := config.Parallel[tool]
+	configMu.RUnlock()
+	if max <= 0 {
+		return func() {}, nil
+	}
+	toolsMu.Lock()
+	t := tools[tool]
+	if t == nil {
+		t = new(toolSlots)
+		tools[tool] = t
+	}
+	release := func() {
+		toolsMu.Lock()
+		defer toolsMu.Unlock()
+		if len(t.waiting) > 0 {
+			// Hand the slot to the longest waiting command.
+			close(t.waiting[0])
+			t.waiting = t.waiting[1:]
+			return
+		}
+		t.running--
+	}
+	if t.running < max && len(t.waiting) == 0 {
+		t.running++
+		toolsMu.Unlock()
+		return release, nil
+	}
+	ready := make(chan struct{})
+	t.waiting = append(t.waiting, ready)
+	toolsMu.Unlock()
+	select {
+	case <-ready:
+		return release, nil
+	case <-ctx.Done():
+	}
+	toolsMu.Lock()
+	for i, w := range t.waiting {
+		if w == ready {
+			t.waiting = append(t.waiting[:i], t.waiting[i+1:]...)
+			toolsMu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+	toolsMu.Unlock()
+	// The slot was handed over as ctx finished; pass it on.
+	release()
+	return nil, ctx.Err()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestPatchGolden reformats a fake window holding the old file of each
+// directory in testdata/patch into its new file, and compares the
+// edits made with its golden file.
+func TestPatchGolden(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "patch", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			old := readTestFile(t, filepath.Join(dir, "old"))
+			new := readTestFile(t, filepath.Join(dir, "new"))
+			w := &fakeWindow{body: append([]byte{}, old...)}
+			applyHunks(w, new, internalDiff(old, new), "mark")
+			if !bytes.Equal(w.body, new) {
+				t.Errorf("window holds %q, want %q", w.body, new)
+			}
+			got := []byte(strings.Join(w.ops, "\n") + "\n")
+			golden := filepath.Join(dir, "golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0666); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if want := readTestFile(t, golden); !bytes.Equal(got, want) {
+				t.Errorf("edits:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func readTestFile(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// A preview is a window showing changes a formatter would make.
+type preview struct {
+	w *acme.Win
+	// apply applies the previewed changes. It is run in the main loop.
+	apply func() error
+}
+
+// previews holds preview windows by name.
+var previews = map[string]*preview{}
+
+// showPreview shows the hunks turning old into new, the contents of
+// the file name open in window id, in a window named name+"+Preview".
+// Runs of unchanged lines longer than the configured context are
+// folded. Executing Apply in the preview window applies the changes,
+// unless the window has been edited since.
+func showPreview(id int, name string, old, new []byte, hunks []hunk) {
+	pname := name + "+Preview"
+	p := previews[pname]
+	if p == nil {
+		w, err := newWindow(pname)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		w.Write("tag", []byte(" Apply"))
+		p = &preview{w: w}
+		previews[pname] = p
+		go p.events(pname)
+	}
+	p.apply = func() error {
+		if !bodyEquals(id, old) {
+			return errors.New("window changed since the preview; not applied")
+		}
+		reformat(id, name, new)
+		return nil
+	}
+
+	p.w.Addr(",")
+	p.w.Write("data", renderDiff(old, new, hunks, config.PreviewContext))
+	p.w.Ctl("clean")
+	p.w.Addr("#0")
+	p.w.Ctl("dot=addr")
+	p.w.Ctl("show")
+}
+
+func (p *preview) events(pname string) {
+	for e := range p.w.EventChan() {
+		if (e.C2 == 'x' || e.C2 == 'X') && string(e.Text) == "Apply" {
+			done := make(chan error)
+			mainFuncs <- func() {
+				var err error
+				if p.apply != nil {
+					err = p.apply()
+				}
+				done <- err
+			}
+			if err := <-done; err != nil {
+				emitError(strings.TrimSuffix(pname, "+Preview"), err)
+				continue
+			}
+			p.w.Del(true)
+			continue
+		}
+		p.w.WriteEvent(e)
+	}
+	mainFuncs <- func() { delete(previews, pname) }
+}
+
+// renderDiff renders hunks turning old into new with "- " and "+ "
+// prefixed lines, showing up to context unchanged lines around each
+// hunk and a marker in place of the rest.
+func renderDiff(old, new []byte, hunks []hunk, context int) []byte {
+	oldLines := splitLines(old)
+	newLines := splitLines(new)
+	var b bytes.Buffer
+	// unchanged writes old lines from through to (1-based, inclusive).
+	unchanged := func(from, to int, first, last bool) {
+		n := to - from + 1
+		if n <= 0 {
+			return
+		}
+		head, tail := context, context
+		if first {
+			head = 0
+		}
+		if last {
+			tail = 0
+		}
+		if n <= head+tail {
+			head, tail = n, 0
+		}
+		for i := from; i < from+head; i++ {
+			fmt.Fprintf(&b, "  %s", oldLines[i-1])
+		}
+		if folded := n - head - tail; folded > 0 {
+			fmt.Fprintf(&b, "… %d unchanged lines …\n", folded)
+		}
+		for i := to - tail + 1; i <= to; i++ {
+			fmt.Fprintf(&b, "  %s", oldLines[i-1])
+		}
+	}
+	next := 1
+	for i, h := range hunks {
+		start, end := h.oldStart, h.oldEnd
+		if h.op == 'a' {
+			start, end = h.oldStart+1, h.oldStart
+		}
+		unchanged(next, start-1, i == 0, false)
+		fmt.Fprintf(&b, "@@ %s @@\n", h)
+		for i := start; i <= end && h.op != 'a'; i++ {
+			fmt.Fprintf(&b, "- %s", oldLines[i-1])
+		}
+		for i := h.newStart; i <= h.newEnd && h.op != 'd'; i++ {
+			fmt.Fprintf(&b, "+ %s", newLines[i-1])
+		}
+		next = end + 1
+	}
+	unchanged(next, len(oldLines), false, true)
+	return b.Bytes()
+}
+
+// checkReport describes the hunks turning old into new, the contents
+// of the file name, as addressed diagnostics: one line per hunk
+// followed by the removed and added lines, indented.
+func checkReport(name string, old, new []byte, hunks []hunk) []byte {
+	oldLines := splitLines(old)
+	newLines := splitLines(new)
+	var b bytes.Buffer
+	for _, h := range hunks {
+		switch h.op {
+		case 'a':
+			fmt.Fprintf(&b, "%s:%d: would add %d lines after this line\n", name, h.oldStart, h.newEnd-h.newStart+1)
+		case 'c':
+			fmt.Fprintf(&b, "%s:%d: would change %d lines\n", name, h.oldStart, h.oldEnd-h.oldStart+1)
+		case 'd':
+			fmt.Fprintf(&b, "%s:%d: would delete %d lines\n", name, h.oldStart, h.oldEnd-h.oldStart+1)
+		}
+		if h.op != 'a' {
+			for i := h.oldStart; i <= h.oldEnd; i++ {
+				fmt.Fprintf(&b, "\t- %s", oldLines[i-1])
+			}
+		}
+		if h.op != 'd' {
+			for i := h.newStart; i <= h.newEnd; i++ {
+				fmt.Fprintf(&b, "\t+ %s", newLines[i-1])
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+func (h hunk) String() string {
+	span := func(start, end int) string {
+		if start == end {
+			return fmt.Sprint(start)
+		}
+		return fmt.Sprintf("%d,%d", start, end)
+	}
+	return span(h.oldStart, h.oldEnd) + string(h.op) + span(h.newStart, h.newEnd)
+}
+
+// splitLines splits text into lines, each ending in a newline. A
+// final unterminated line has one added.
+func splitLines(text []byte) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(text), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] += "\n"
+	}
+	return lines
+}
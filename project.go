@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	toml "github.com/pelletier/go-toml"
+)
+
+// projectConfigName is the name of project config files.
+const projectConfigName = ".acmewatch.toml"
+
+// A project is a project config file merged over the global config.
+type project struct {
+	mod       time.Time
+	globalMod time.Time
+	cfg       *Config
+	err       error
+}
+
+var (
+	projectsMu sync.Mutex
+	// projects caches project configs by file name.
+	projects = map[string]*project{}
+)
+
+// configFor returns the config for the file name: the global config
+// merged with the nearest project config above name, if any. It may be
+// called from any goroutine; the config returned must not be modified.
+func configFor(name string) (*Config, error) {
+	root := projectRoot(filepath.Dir(name), []string{projectConfigName})
+	path := filepath.Join(root, projectConfigName)
+	configMu.RLock()
+	global, globalMod := config, lastMod
+	configMu.RUnlock()
+	info, err := os.Stat(path)
+	if err != nil {
+		return global, nil
+	}
+	projectsMu.Lock()
+	defer projectsMu.Unlock()
+	p := projects[path]
+	if p == nil || !p.mod.Equal(info.ModTime()) || !p.globalMod.Equal(globalMod) {
+		p = &project{mod: info.ModTime(), globalMod: globalMod}
+		p.cfg, p.err = readProject(path, global)
+		projects[path] = p
+		if p.err == nil {
+			noteRules(p.cfg.ruleNames())
+			emit(Event{Event: "config", File: path, Outcome: "ok", Message: fmt.Sprintf("read at %s", p.mod)})
+		}
+	}
+	if p.err != nil {
+		return global, fmt.Errorf("%s: %v", path, p.err)
+	}
+	return p.cfg, nil
+}
+
+// readProject reads the project config at path and returns it merged
+// over the global config, global. Its rules come first, so its
+// formatters are preferred, and replace global rules of the same name.
+// Other settings are those of the global config.
+func readProject(path string, global *Config) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var local Config
+	if err := toml.NewDecoder(f).Decode(&local); err != nil {
+		return nil, err
+	}
+	if err := local.checkRules(); err != nil {
+		return nil, err
+	}
+	own := map[string]bool{}
+	for _, n := range local.ruleNames() {
+		own[n] = true
+	}
+	c := *global
+	c.Formatter = local.Formatter
+	for _, fm := range global.Formatter {
+		if !own[fm.Name] {
+			c.Formatter = append(c.Formatter, fm)
+		}
+	}
+	c.Hook = local.Hook
+	for _, h := range global.Hook {
+		if !own[h.Name] {
+			c.Hook = append(c.Hook, h)
+		}
+	}
+	c.Rename = local.Rename
+	for _, h := range global.Rename {
+		if !own[h.Name] {
+			c.Rename = append(c.Rename, h)
+		}
+	}
+	c.Idle = local.Idle
+	for _, r := range global.Idle {
+		if !own[r.Name] {
+			c.Idle = append(c.Idle, r)
+		}
+	}
+	c.Filter = append(local.Filter, global.Filter...)
+	c.Exclude = append(local.Exclude, global.Exclude...)
+	c.Outline = append(local.Outline, global.Outline...)
+	c.Warm = local.Warm
+	for _, r := range global.Warm {
+		if !own[r.Name] {
+			c.Warm = append(c.Warm, r)
+		}
+	}
+	if err := c.checkCompare(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// projectRuleNames returns the names of the rules of the project
+// configs read so far.
+func projectRuleNames() []string {
+	projectsMu.Lock()
+	defer projectsMu.Unlock()
+	var names []string
+	for _, p := range projects {
+		if p.cfg != nil {
+			names = append(names, p.cfg.ruleNames()...)
+		}
+	}
+	return names
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	toml "github.com/pelletier/go-toml"
+)
+
+// python formats a Python file with the tools its project's
+// pyproject.toml configures, in the order they must run: ruff if it
+// has a [tool.ruff] section, otherwise isort (if configured) and then
+// black. The tools run in turn on the contents, so the window is
+// rewritten once with their combined changes.
+func python(ctx context.Context, fm *Formatter, name string, src []byte) ([]byte, error) {
+	root := projectRoot(filepath.Dir(name), []string{"pyproject.toml"})
+	var tree *toml.Tree
+	if t, err := toml.LoadFile(filepath.Join(root, "pyproject.toml")); err == nil {
+		tree = t
+	}
+	has := func(key string) bool { return tree != nil && tree.Has(key) }
+	return pipe(ctx, name, src, pythonTools(name, root, has))
+}
+
+// pythonTools returns the commands formatting the Python file name in
+// the project at root, where has reports whether pyproject.toml has a
+// key.
+func pythonTools(name, root string, has func(string) bool) []Command {
+	var cmds []Command
+	if has("tool.ruff") {
+		if has("tool.ruff.isort") || has("tool.ruff.lint.isort") {
+			cmds = append(cmds, Command{Cmd: "ruff", Args: []string{"check", "--select", "I", "--fix", "--quiet", "--stdin-filename", name, "-"}})
+		}
+		cmds = append(cmds, Command{Cmd: "ruff", Args: []string{"format", "--quiet", "--stdin-filename", name, "-"}})
+	} else {
+		if has("tool.isort") {
+			args := []string{"--filename", name}
+			if !has("tool.isort.profile") {
+				args = append(args, "--profile", "black")
+			}
+			cmds = append(cmds, Command{Cmd: "isort", Args: append(args, "-")})
+		}
+		cmds = append(cmds, Command{Cmd: "black", Args: []string{"--quiet", "--stdin-filename", name, "-"}})
+	}
+	for i := range cmds {
+		cmds[i].Dir = root
+		cmds[i].Stdout = true
+	}
+	return cmds
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A job is a hook waiting for or holding one of the queue's slots.
+type job struct {
+	rule    string
+	file    string
+	cost    time.Duration
+	queued  time.Time
+	started time.Time
+	ready   chan struct{}
+	// ctx is done once the job is cancelled.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// queue schedules hooks. It favors cheap jobs, but a job that has
+// waited longer than the configured maximum runs next regardless of
+// cost, so expensive hooks are not starved.
+var queue struct {
+	mu      sync.Mutex
+	running []*job
+	waiting []*job
+}
+
+// acquireJob blocks until the hook rule, with expected duration cost,
+// may run for file.
+func acquireJob(rule, file string, cost time.Duration) *job {
+	j := &job{rule: rule, file: file, cost: cost, queued: time.Now(), ready: make(chan struct{})}
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	queue.mu.Lock()
+	queue.waiting = append(queue.waiting, j)
+	scheduleLocked()
+	queue.mu.Unlock()
+	<-j.ready
+	return j
+}
+
+// releaseJob gives up j's slot.
+func releaseJob(j *job) {
+	j.cancel()
+	queue.mu.Lock()
+	for i, r := range queue.running {
+		if r == j {
+			queue.running = append(queue.running[:i], queue.running[i+1:]...)
+			break
+		}
+	}
+	scheduleLocked()
+	queue.mu.Unlock()
+}
+
+func scheduleLocked() {
+	configMu.RLock()
+	jobs, maxWait := config.Queue.Jobs, config.Queue.MaxWait
+	configMu.RUnlock()
+	for len(queue.running) < jobs && len(queue.waiting) > 0 {
+		now := time.Now()
+		best := 0
+		for i, j := range queue.waiting {
+			b := queue.waiting[best]
+			starved, bestStarved := now.Sub(j.queued) > maxWait, now.Sub(b.queued) > maxWait
+			switch {
+			case starved != bestStarved:
+				if starved {
+					best = i
+				}
+			case starved:
+				if j.queued.Before(b.queued) {
+					best = i
+				}
+			case j.cost < b.cost:
+				best = i
+			}
+		}
+		j := queue.waiting[best]
+		queue.waiting = append(queue.waiting[:best], queue.waiting[best+1:]...)
+		j.started = now
+		queue.running = append(queue.running, j)
+		close(j.ready)
+	}
+}
+
+// hookCost returns the expected duration of h: its configured cost,
+// else its mean duration so far, else one second.
+func hookCost(h *Hook) time.Duration {
+	if h.Cost > 0 {
+		return h.Cost
+	}
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	loadStatsLocked()
+	if rs := stats[h.Name]; rs != nil && rs.Runs > 0 {
+		return time.Duration(rs.Seconds / float64(rs.Runs) * float64(time.Second))
+	}
+	return time.Second
+}
+
+// listQueue lists the running and waiting hooks.
+func listQueue([]string) (string, error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	var b strings.Builder
+	now := time.Now()
+	for _, j := range queue.running {
+		fmt.Fprintf(&b, "running\t%s\t%s\t%s\n", j.rule, j.file, now.Sub(j.started).Round(time.Second))
+	}
+	waiting := append([]*job(nil), queue.waiting...)
+	sort.Slice(waiting, func(i, k int) bool { return waiting[i].queued.Before(waiting[k].queued) })
+	for _, j := range waiting {
+		fmt.Fprintf(&b, "waiting\t%s\t%s\t%s\n", j.rule, j.file, now.Sub(j.queued).Round(time.Second))
+	}
+	return b.String(), nil
+}
+
+// cancelJobs cancels the running and waiting hooks of rule, only for
+// file if it is not empty, and returns how many it cancelled. Running
+// hooks are killed; waiting ones are dropped from the queue.
+func cancelJobs(rule, file string) int {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	n := 0
+	matches := func(j *job) bool {
+		return j.rule == rule && (file == "" || j.file == file)
+	}
+	for _, j := range queue.running {
+		if matches(j) && j.ctx.Err() == nil {
+			j.cancel()
+			n++
+		}
+	}
+	waiting := queue.waiting[:0]
+	for _, j := range queue.waiting {
+		if matches(j) {
+			j.cancel()
+			close(j.ready)
+			n++
+			continue
+		}
+		waiting = append(waiting, j)
+	}
+	queue.waiting = waiting
+	return n
+}
+
+// cancelHook is the cancel control command: cancel rule [file].
+func cancelHook(args []string) (string, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return "", errors.New("usage: cancel rule [file]")
+	}
+	file := ""
+	if len(args) == 2 {
+		file = args[1]
+	}
+	return fmt.Sprintf("cancelled %d", cancelJobs(args[0], file)), nil
+}
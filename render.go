@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Render configures the render builtin hook, which draws Graphviz and
+// PlantUML diagrams on save.
+type Render struct {
+	// Format is the image format: "svg" (the default) or "png".
+	Format string
+	// Dir is the directory images are written to. It defaults to the
+	// file's directory; a relative Dir is relative to that directory.
+	Dir string
+}
+
+// render draws the diagram in name with dot (.dot and .gv files) or
+// plantuml (others) into an image of the same base name. If h.Plumb
+// is set the image is plumbed once drawn, so a viewer shows or
+// refreshes it.
+func render(ctx context.Context, h *Hook, name string) ([]byte, error) {
+	format := h.Render.Format
+	if format == "" {
+		format = "svg"
+	}
+	dir := filepath.Dir(name)
+	if h.Render.Dir != "" {
+		d := expandTilde(h.Render.Dir)
+		if !filepath.IsAbs(d) {
+			d = filepath.Join(dir, d)
+		}
+		dir = d
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	img := filepath.Join(dir, base+"."+format)
+	var c Command
+	switch filepath.Ext(name) {
+	case ".dot", ".gv":
+		c = Command{Cmd: "dot", Args: []string{"-T" + format, "-o", img, "$name"}}
+	default:
+		c = Command{Cmd: "plantuml", Args: []string{"-t" + format, "-o", dir, "$name"}}
+	}
+	if out, err := c.runContext(ctx, name, name, nil); err != nil {
+		return out, err
+	}
+	if h.Plumb {
+		if out, err := exec.Command("9", "plumb", img).CombinedOutput(); err != nil {
+			return bytes.TrimSpace(out), err
+		}
+	}
+	return []byte(fmt.Sprintf("wrote %s\n", img)), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+)
+
+// rustfmt formats a Rust file with rustfmt, passing the edition from
+// the package's Cargo.toml.
+func rustfmt(ctx context.Context, fm *Formatter, name string, src []byte) ([]byte, error) {
+	c := Command{Cmd: "rustfmt", Args: []string{"--emit", "stdout"}, Stdout: true}
+	if root, ok := cargoRoot(name); ok {
+		edition := "2015"
+		if t, err := toml.LoadFile(filepath.Join(root, "Cargo.toml")); err == nil {
+			if e, ok := t.Get("package.edition").(string); ok {
+				edition = e
+			}
+		}
+		c.Args = append(c.Args, "--edition", edition)
+		c.Dir = root
+	}
+	return pipe(ctx, name, src, []Command{c})
+}
+
+// clippy runs cargo clippy on the package containing name and returns
+// its diagnostics, with file names made absolute.
+func clippy(ctx context.Context, h *Hook, name string) ([]byte, error) {
+	root, ok := cargoRoot(name)
+	if !ok {
+		return nil, fmt.Errorf("no Cargo.toml above %s", name)
+	}
+	c := Command{Cmd: "cargo", Args: []string{"clippy", "--quiet", "--message-format=short"}, Dir: root}
+	out, err := c.runContext(ctx, name, name, nil)
+	lines := strings.Split(string(out), "\n")
+	for i, line := range lines {
+		if m := diagRe.FindStringSubmatch(line); m != nil && !filepath.IsAbs(m[1]) {
+			lines[i] = filepath.Join(root, m[1]) + line[len(m[1]):]
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), err
+}
+
+// cargoRoot returns the directory of the Cargo.toml nearest above name.
+func cargoRoot(name string) (string, bool) {
+	root := projectRoot(filepath.Dir(name), []string{"Cargo.toml"})
+	_, err := os.Stat(filepath.Join(root, "Cargo.toml"))
+	return root, err == nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+)
+
+// rootList is a flag holding directories, one per use of the flag.
+type rootList []string
+
+func (r *rootList) String() string { return strings.Join(*r, ",") }
+
+func (r *rootList) Set(dir string) error {
+	abs, err := filepath.Abs(expandTilde(dir))
+	if err != nil {
+		return err
+	}
+	*r = append(*r, abs)
+	return nil
+}
+
+var roots rootList
+
+func init() {
+	flag.Var(&roots, "root", "only watch files under `dir`; may be repeated")
+}
+
+// inScope reports whether acmewatch handles the file name: whether it
+// is under one of the -root directories or the config's scope, if
+// either is set.
+func inScope(name string) bool {
+	dirs := append(roots[:len(roots):len(roots)], config.Scope...)
+	if len(dirs) == 0 {
+		return true
+	}
+	for _, d := range dirs {
+		if rel, err := filepath.Rel(d, name); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
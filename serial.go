@@ -0,0 +1,54 @@
+package main
+
+import "9fans.net/go/acme"
+
+// A heldEvent is an event waiting for its window's earlier put to
+// finish.
+type heldEvent struct {
+	event  acme.LogEvent
+	origin string
+}
+
+// busyWindows holds the windows whose put is being processed, and
+// heldEvents the events that arrived for them since, in order. Puts of
+// different windows are processed at once, but each window's events
+// are handled one at a time. They are used only by the main loop.
+var (
+	busyWindows = map[int]bool{}
+	heldEvents  = map[int][]heldEvent{}
+)
+
+// dispatch handles event now or, if its window is busy, once the
+// window's earlier events are done.
+func dispatch(event acme.LogEvent, origin string) {
+	if busyWindows[event.ID] {
+		heldEvents[event.ID] = append(heldEvents[event.ID], heldEvent{event, origin})
+		return
+	}
+	handle(event, origin)
+}
+
+// windowIdle marks window id no longer busy and handles its held
+// events until one makes it busy again.
+func windowIdle(id int) {
+	delete(busyWindows, id)
+	for len(heldEvents[id]) > 0 && !busyWindows[id] {
+		h := heldEvents[id][0]
+		heldEvents[id] = heldEvents[id][1:]
+		handle(h.event, h.origin)
+	}
+	if len(heldEvents[id]) == 0 {
+		delete(heldEvents, id)
+	}
+}
+
+// onMain runs fn in the main loop and waits for it. It must not be
+// called from the main loop.
+func onMain(fn func()) {
+	done := make(chan struct{})
+	mainFuncs <- func() {
+		fn()
+		close(done)
+	}
+	<-done
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A ServeRule renders matching files for the live preview server.
+type ServeRule struct {
+	Matcher
+	// Command renders the file, given on stdin, as HTML. Without
+	// one the file is served as it is.
+	Command
+}
+
+var (
+	serveOnce sync.Once
+	// putBus carries the names of files as they are put.
+	putBus broadcaster
+)
+
+// startServer starts the live preview server the first time the config
+// has serve rules.
+func startServer() {
+	if len(config.Serve) == 0 {
+		return
+	}
+	serveOnce.Do(func() {
+		ln, err := net.Listen("tcp", config.ServeAddr)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		emit(Event{Event: "serve", Outcome: "ok", Message: "previews at http://" + ln.Addr().String() + "/"})
+		mux := http.NewServeMux()
+		mux.HandleFunc("/view/", serveView)
+		mux.HandleFunc("/events/", serveEvents)
+		go func() {
+			log.Print(http.Serve(ln, mux))
+		}()
+	})
+}
+
+// servePut tells previews of name to reload.
+func servePut(name string) {
+	if putBus.active() {
+		putBus.send([]byte(name))
+	}
+}
+
+// serveRule returns the serve rule matching name, or nil if none does.
+func serveRule(name string) *ServeRule {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	for _, r := range config.Serve {
+		if matched, _ := r.matches(name); matched {
+			return r
+		}
+	}
+	return nil
+}
+
+// reloadScript reloads the page when its file is put.
+const reloadScript = `<script>new EventSource(%q).onmessage = function() { location.reload(); };</script>`
+
+// serveView serves /view/file: the file rendered by its serve rule,
+// with a script reloading it each time the file is put.
+func serveView(w http.ResponseWriter, r *http.Request) {
+	name := "/" + r.URL.Path[len("/view/"):]
+	rule := serveRule(name)
+	if rule == nil {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadFile(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if rule.Cmd != "" {
+		out, err := rule.run(name, bytes.NewReader(body))
+		if err != nil {
+			body = []byte("<pre>" + html.EscapeString(string(out)) + "</pre>")
+		} else {
+			body = out
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", html.EscapeString(filepath.Base(name)))
+	fmt.Fprintf(w, reloadScript+"\n", "/events"+name)
+	w.Write(body)
+}
+
+// serveEvents serves /events/file: a stream of server-sent events, one
+// each time the file is put.
+func serveEvents(w http.ResponseWriter, r *http.Request) {
+	name := "/" + r.URL.Path[len("/events/"):]
+	f, ok := w.(http.Flusher)
+	if !ok || serveRule(name) == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	f.Flush()
+	c := putBus.subscribe()
+	defer putBus.unsubscribe(c)
+	for {
+		select {
+		case put := <-c:
+			if !sameFile(string(put), name) {
+				continue
+			}
+			fmt.Fprintf(w, "data: put\n\n")
+			f.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// sameFile reports whether a and b name the same file.
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ai, err1 := os.Stat(a)
+	bi, err2 := os.Stat(b)
+	return err1 == nil && err2 == nil && os.SameFile(ai, bi)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Severity configures how diagnostic lines are marked by severity.
+type Severity struct {
+	// Error, Warning, and Other are prefixed to diagnostics of that
+	// severity.
+	Error   string
+	Warning string
+	Other   string
+	// Group sorts diagnostics so errors come first, then warnings,
+	// then the rest.
+	Group bool
+}
+
+var (
+	errorRe   = regexp.MustCompile(`(?i)\b(error|fatal|panic)\b`)
+	warningRe = regexp.MustCompile(`(?i)\b(warning|warn)\b`)
+)
+
+// markSeverity prefixes each diagnostic in diag with the glyph sv sets
+// for its severity and, if sv says so, groups them by severity.
+// Indented lines are treated as continuations of the line before.
+func markSeverity(sv Severity, diag string) string {
+	if diag == "" || (sv.Error == "" && sv.Warning == "" && sv.Other == "" && !sv.Group) {
+		return diag
+	}
+	type item struct {
+		rank  int
+		lines []string
+	}
+	var items []*item
+	for _, line := range strings.Split(strings.TrimRight(diag, "\n"), "\n") {
+		if len(items) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			it := items[len(items)-1]
+			it.lines = append(it.lines, line)
+			continue
+		}
+		it := &item{rank: 2}
+		prefix := sv.Other
+		switch {
+		case errorRe.MatchString(line):
+			it.rank, prefix = 0, sv.Error
+		case warningRe.MatchString(line):
+			it.rank, prefix = 1, sv.Warning
+		}
+		it.lines = []string{prefix + line}
+		items = append(items, it)
+	}
+	if sv.Group {
+		sort.SliceStable(items, func(i, j int) bool { return items[i].rank < items[j].rank })
+	}
+	var b strings.Builder
+	for _, it := range items {
+		for _, line := range it.lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
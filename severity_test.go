@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestMarkSeverity(t *testing.T) {
+	marks := Severity{Error: "E ", Warning: "W ", Other: "- "}
+	for _, tt := range []struct {
+		sv         Severity
+		diag, want string
+	}{
+		{Severity{}, "a.go:1: error: bad\n", "a.go:1: error: bad\n"},
+		{marks, "", ""},
+		{marks, "a.go:1: error: bad", "E a.go:1: error: bad\n"},
+		{marks, "a.go:1: warning: odd\n", "W a.go:1: warning: odd\n"},
+		{marks, "a.go:1: note\n", "- a.go:1: note\n"},
+		{marks, "a.go:1: FATAL\n", "E a.go:1: FATAL\n"},
+		{marks, "a.go:1: errors.go is fine\n", "- a.go:1: errors.go is fine\n"},
+		{marks, "a.go:1: panic: x\n\tgoroutine 1\n", "E a.go:1: panic: x\n\tgoroutine 1\n"},
+		{
+			Severity{Group: true},
+			"a.go:1: note\na.go:2: warn: w\na.go:3: error: e\n  more e\na.go:4: error: f\n",
+			"a.go:3: error: e\n  more e\na.go:4: error: f\na.go:2: warn: w\na.go:1: note\n",
+		},
+	} {
+		if got := markSeverity(tt.sv, tt.diag); got != tt.want {
+			t.Errorf("markSeverity(%+v, %q) = %q, want %q", tt.sv, tt.diag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shellDialects maps shell names, from shebangs or file extensions, to
+// the dialect names of shfmt -ln and shellcheck -s.
+var shellDialects = map[string][2]string{
+	"sh":   {"posix", "sh"},
+	"dash": {"posix", "dash"},
+	"ash":  {"posix", "sh"},
+	"bash": {"bash", "bash"},
+	"ksh":  {"mksh", "ksh"},
+	"mksh": {"mksh", "ksh"},
+	"bats": {"bats", "bash"},
+}
+
+// shellDialect returns the shfmt and shellcheck dialects of a shell
+// script with contents src, from its shebang or else the extension of
+// name. They are empty if unknown.
+func shellDialect(name string, src []byte) (shfmt, shellcheck string) {
+	shell := strings.TrimPrefix(filepath.Ext(name), ".")
+	if bytes.HasPrefix(src, []byte("#!")) {
+		line := src[2:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(string(line))
+		if len(f) > 0 {
+			shell = filepath.Base(f[0])
+		}
+		if shell == "env" {
+			shell = ""
+			for _, a := range f[1:] {
+				if !strings.HasPrefix(a, "-") {
+					shell = filepath.Base(a)
+					break
+				}
+			}
+		}
+	}
+	d := shellDialects[shell]
+	return d[0], d[1]
+}
+
+// shfmt formats a shell script with shfmt in the script's dialect.
+func shfmt(ctx context.Context, fm *Formatter, name string, src []byte) ([]byte, error) {
+	c := Command{Cmd: "shfmt", Args: []string{"--filename", name}, Stdout: true}
+	if ln, _ := shellDialect(name, src); ln != "" {
+		c.Args = append(c.Args, "-ln", ln)
+	}
+	return pipe(ctx, name, src, []Command{c})
+}
+
+// shellcheck lints a shell script with shellcheck in the script's
+// dialect.
+func shellcheck(ctx context.Context, h *Hook, name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head, _ := bufio.NewReader(f).Peek(256)
+	c := Command{Cmd: "shellcheck", Args: []string{"--format", "gcc"}}
+	if _, s := shellDialect(name, head); s != "" {
+		c.Args = append(c.Args, "-s", s)
+	}
+	c.Args = append(c.Args, "$name")
+	return c.runContext(ctx, name, name, nil)
+}
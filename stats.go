@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// ruleStats is the persisted record of a rule's runs.
+type ruleStats struct {
+	Runs     int       `json:"runs"`
+	Failures int       `json:"failures"`
+	Seconds  float64   `json:"seconds"`
+	LastRun  time.Time `json:"last_run"`
+	// Since is when the rule was first seen in a config.
+	Since time.Time `json:"since,omitempty"`
+	// LastMatch is when the rule last matched a file, whether or
+	// not it then ran.
+	LastMatch time.Time `json:"last_match,omitempty"`
+}
+
+var (
+	statsMu sync.Mutex
+	stats   map[string]*ruleStats
+)
+
+func statsPath() (string, error) {
+	return xdg.DataFile("acmewatch/stats.json")
+}
+
+func readStats() (map[string]*ruleStats, error) {
+	path, err := statsPath()
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]*ruleStats{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return m, nil
+}
+
+// recordRun adds the run of a rule described by e to the persisted
+// statistics.
+func recordRun(e Event) {
+	if e.Rule == "" {
+		return
+	}
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	loadStatsLocked()
+	rs := stats[e.Rule]
+	if rs == nil {
+		rs = new(ruleStats)
+		stats[e.Rule] = rs
+	}
+	rs.Runs++
+	if e.Outcome == "failed" {
+		rs.Failures++
+	}
+	rs.Seconds += e.Duration
+	rs.LastRun = e.Time
+	rs.LastMatch = e.Time
+	if err := saveStats(); err != nil {
+		log.Print(err)
+	}
+}
+
+// noteRules records when each of the rules names was first seen in a
+// config, to tell rules that never match from ones just added.
+func noteRules(names []string) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	loadStatsLocked()
+	added := false
+	for _, name := range names {
+		if stats[name] == nil {
+			stats[name] = &ruleStats{Since: time.Now()}
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+	if err := saveStats(); err != nil {
+		log.Print(err)
+	}
+}
+
+// recordMatches records that the rules names matched a file.
+func recordMatches(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	loadStatsLocked()
+	now := time.Now()
+	for _, name := range names {
+		rs := stats[name]
+		if rs == nil {
+			rs = &ruleStats{Since: now}
+			stats[name] = rs
+		}
+		rs.LastMatch = now
+	}
+	if err := saveStats(); err != nil {
+		log.Print(err)
+	}
+}
+
+// loadStatsLocked reads the persisted statistics if they have not been
+// yet. The caller must hold statsMu.
+func loadStatsLocked() {
+	if stats != nil {
+		return
+	}
+	var err error
+	if stats, err = readStats(); err != nil {
+		log.Print(err)
+		stats = map[string]*ruleStats{}
+	}
+}
+
+func saveStats() error {
+	path, err := statsPath()
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(stats, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// printStats prints the persisted statistics of every rule, followed by
+// the configured rules that have matched no file in the last days days.
+func printStats(days int) error {
+	m, err := readStats()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name, rs := range m {
+		if rs.Runs > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "RULE\tRUNS\tFAILURES\tMEAN\tLAST RUN\n")
+	for _, name := range names {
+		rs := m[name]
+		mean := time.Duration(rs.Seconds / float64(rs.Runs) * float64(time.Second))
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", name, rs.Runs, rs.Failures,
+			mean.Round(time.Millisecond), rs.LastRun.Format("2006-01-02 15:04"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if err := readConfig(); err != nil {
+		return err
+	}
+	unused := unmatchedRules(m, config.ruleNames(), time.Now().AddDate(0, 0, -days))
+	if len(unused) > 0 {
+		fmt.Printf("\nwarning: no match in the last %d days; check their globs:\n", days)
+		for _, name := range unused {
+			fmt.Printf("\t%s\n", name)
+		}
+	}
+	return nil
+}
+
+// unmatchedRules returns the rules of names, seen in a config before
+// cutoff, that have not matched a file since.
+func unmatchedRules(m map[string]*ruleStats, names []string, cutoff time.Time) []string {
+	var unused []string
+	for _, name := range names {
+		rs := m[name]
+		if rs == nil {
+			continue
+		}
+		since := rs.Since
+		if since.IsZero() {
+			// Recorded before Since was.
+			since = rs.LastRun
+		}
+		if since.Before(cutoff) && rs.LastMatch.Before(cutoff) && rs.LastRun.Before(cutoff) {
+			unused = append(unused, name)
+		}
+	}
+	return unused
+}
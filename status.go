@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"9fans.net/go/acme"
+)
+
+// statusName is the name of the status window.
+const statusName = "/acmewatch/+Status"
+
+// status is the status window, which shows the running and waiting
+// hooks. It is used only by the main loop.
+var status struct {
+	w *acme.Win
+	// rows holds the job shown on each line.
+	rows  []*job
+	frame int
+}
+
+// openStatus opens the status window, or shows it if it is open.
+func openStatus() error {
+	if status.w != nil {
+		return status.w.Ctl("show")
+	}
+	w, err := newWindow(statusName)
+	if err != nil {
+		return err
+	}
+	w.Write("tag", []byte(" Cancel"))
+	status.w = w
+	go statusEvents(w)
+	refreshStatus()
+	return nil
+}
+
+// spinner holds the frames of the running hooks' spinner.
+const spinner = `|/-\`
+
+// refreshStatus redraws the status window, if open: one line per hook
+// with its state and time so far, and a Cancel to execute.
+func refreshStatus() {
+	if status.w == nil {
+		return
+	}
+	queue.mu.Lock()
+	running := append([]*job(nil), queue.running...)
+	waiting := append([]*job(nil), queue.waiting...)
+	queue.mu.Unlock()
+
+	status.frame++
+	now := time.Now()
+	var b strings.Builder
+	status.rows = status.rows[:0]
+	for _, j := range running {
+		fmt.Fprintf(&b, "%c %s\t%s\t%s\tCancel\n", spinner[status.frame%len(spinner)], now.Sub(j.started).Round(time.Second), j.rule, j.file)
+		status.rows = append(status.rows, j)
+	}
+	for _, j := range waiting {
+		fmt.Fprintf(&b, "  waiting %s\t%s\t%s\tCancel\n", now.Sub(j.queued).Round(time.Second), j.rule, j.file)
+		status.rows = append(status.rows, j)
+	}
+	if b.Len() == 0 {
+		b.WriteString("no hooks running\n")
+	}
+	status.w.Addr(",")
+	status.w.Write("data", []byte(b.String()))
+	status.w.Ctl("clean")
+}
+
+// statusEvents handles the status window's events. Executing Cancel on
+// a hook's line in the body cancels it; Cancel with arguments is the
+// cancel control command.
+func statusEvents(w *acme.Win) {
+	for e := range w.EventChan() {
+		f := strings.Fields(string(e.Text))
+		if (e.C2 != 'x' && e.C2 != 'X') || len(f) == 0 || f[0] != "Cancel" {
+			w.WriteEvent(e)
+			continue
+		}
+		args := append(f[1:], strings.Fields(string(e.Arg))...)
+		line := -1
+		// Only a body event's offset gives a line; acme marks them with
+		// an upper case X.
+		if len(args) == 0 && e.C2 == 'X' {
+			body, err := w.ReadAll("body")
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			line = lineAt(body, e.Q0)
+		}
+		mainFuncs <- func() {
+			switch {
+			case len(args) > 0:
+				if _, err := cancelHook(args); err != nil {
+					emitError(statusName, err)
+				}
+			case line >= 0 && line < len(status.rows):
+				j := status.rows[line]
+				cancelJobs(j.rule, j.file)
+			}
+			refreshStatus()
+		}
+	}
+	mainFuncs <- func() { status.w = nil }
+}
+
+// lineAt returns the 0-based line of text containing rune offset q.
+func lineAt(text []byte, q int) int {
+	line := 0
+	for i := 0; i < len(text) && q > 0; q-- {
+		r, n := utf8.DecodeRune(text[i:])
+		if r == '\n' {
+			line++
+		}
+		i += n
+	}
+	return line
+}
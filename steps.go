@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A step is one formatter or hook run in response to a put.
+type step struct {
+	kind string
+	// async steps run in the background through the queue.
+	async bool
+	cost  time.Duration
+	name  string
+	after []string
+	// skipUnchanged skips the step if the steps it comes after left
+	// the file unchanged.
+	skipUnchanged bool
+	// noop steps are known to leave the file unchanged and are not run.
+	noop  bool
+	chain Chain
+	cmd   *Command
+	// run returns diagnostics to report along with its error. It
+	// stops early if ctx is done.
+	run func(ctx context.Context) ([]byte, error)
+	// skipped, if set, is called when the step does not run because a
+	// step it comes after failed or it is cooling down.
+	skipped func()
+
+	done      chan struct{}
+	err       error
+	unchanged bool
+}
+
+// errUnchanged is returned by a step's run function when it left the
+// file unchanged.
+var errUnchanged = errors.New("unchanged")
+
+// errCancelled reports a hook cancelled with the cancel control
+// command.
+var errCancelled = errors.New("cancelled")
+
+// errWindowChanged is returned by a formatter step whose window was
+// edited while it ran, so that its output was not applied.
+var errWindowChanged = errors.New("window changed; not applied")
+
+// runSteps runs steps for the file name, open in window id, in
+// dependency order and emits an event for each. A step starts once
+// every step named in its after list has finished; steps with no
+// ordering between them run concurrently. Names in after that match no
+// step are ignored. A step whose dependency failed is skipped.
+// runSteps returns once the steps that are not async, the formatters,
+// have finished.
+func runSteps(id int, name string, steps []*step) error {
+	byName := map[string]*step{}
+	for _, s := range steps {
+		if s.name != "" {
+			byName[s.name] = s
+		}
+	}
+	if err := checkCycles(steps, byName); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	// formatted is closed once the steps that are not async have
+	// finished, so that strict mode's banner goes in after the
+	// formatting is applied rather than being undone by it.
+	formatted := make(chan struct{})
+	var matched []string
+	for _, s := range steps {
+		s.done = make(chan struct{})
+		matched = append(matched, s.name)
+	}
+	recordMatches(matched)
+	for _, s := range steps {
+		if !s.async {
+			wg.Add(1)
+		}
+		go func(s *step) {
+			if !s.async {
+				defer wg.Done()
+			}
+			defer close(s.done)
+			deps, unchanged := 0, 0
+			for _, a := range s.after {
+				dep := byName[a]
+				if dep == nil {
+					continue
+				}
+				<-dep.done
+				if dep.err != nil {
+					s.err = fmt.Errorf("skipped: %s failed", a)
+					emit(Event{Event: s.kind, File: name, Rule: s.name, Outcome: "skipped", Message: s.err.Error()})
+					if s.skipped != nil {
+						s.skipped()
+					}
+					return
+				}
+				deps++
+				if dep.unchanged {
+					unchanged++
+				}
+			}
+			if s.noop || (s.skipUnchanged && deps > 0 && unchanged == deps) {
+				s.unchanged = true
+				emit(Event{Event: s.kind, File: name, Rule: s.name, Outcome: "unchanged"})
+				return
+			}
+			if until, ok := coolingDown(s.name, name); ok {
+				s.err = fmt.Errorf("skipped: cooling down until %s", until.Format("15:04:05"))
+				emit(Event{Event: s.kind, File: name, Rule: s.name, Outcome: "skipped", Message: s.err.Error()})
+				if s.skipped != nil {
+					s.skipped()
+				}
+				return
+			}
+			ctx := context.Background()
+			if s.async {
+				j := acquireJob(s.name, name, s.cost)
+				defer releaseJob(j)
+				ctx = j.ctx
+			}
+			recordVersion(s.name, s.cmd)
+			start := time.Now()
+			diag, err := s.run(ctx)
+			if ctx.Err() != nil {
+				err = errCancelled
+			}
+			if err == errUnchanged {
+				s.unchanged = true
+				err = nil
+			}
+			s.err = err
+			e := Event{
+				Time:        time.Now(),
+				Event:       s.kind,
+				File:        name,
+				Rule:        s.name,
+				Duration:    time.Since(start).Seconds(),
+				Outcome:     "ok",
+				Diagnostics: string(diag),
+			}
+			switch {
+			case err == errWindowChanged:
+				e.Outcome = "skipped"
+				e.Message = err.Error()
+			case err != nil:
+				e.Outcome = "failed"
+				e.Message = err.Error()
+			case s.unchanged:
+				e.Outcome = "unchanged"
+			}
+			emit(e)
+			recordRun(e)
+			if err != errCancelled && err != errWindowChanged {
+				recordOutcome(s.name, name, err)
+				go func() {
+					<-formatted
+					if err != nil {
+						strictFail(id, name, s.name, err)
+					} else {
+						strictPass(id, name, s.name)
+					}
+				}()
+			}
+			runChain(s.chain, name, s.name, e)
+		}(s)
+	}
+	wg.Wait()
+	close(formatted)
+	return nil
+}
+
+func checkCycles(steps []*step, byName map[string]*step) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[*step]int{}
+	var visit func(s *step, path []string) error
+	visit = func(s *step, path []string) error {
+		switch state[s] {
+		case visiting:
+			return fmt.Errorf("ordering cycle: %s", strings.Join(append(path, s.name), " -> "))
+		case visited:
+			return nil
+		}
+		state[s] = visiting
+		for _, a := range s.after {
+			if dep := byName[a]; dep != nil {
+				if err := visit(dep, append(path, s.name)); err != nil {
+					return err
+				}
+			}
+		}
+		state[s] = visited
+		return nil
+	}
+	for _, s := range steps {
+		if err := visit(s, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckCycles(t *testing.T) {
+	for _, tt := range []struct {
+		// steps lists each step as its name followed by those it
+		// comes after.
+		steps []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"a", "b a", "c a b"}, ""},
+		{[]string{"c a b", "b a", "a"}, ""},
+		{[]string{"a missing"}, ""},
+		{[]string{"a a"}, "ordering cycle: a -> a"},
+		{[]string{"a b", "b a"}, "ordering cycle: a -> b -> a"},
+		{[]string{"a", "b c", "c d", "d b"}, "ordering cycle: b -> c -> d -> b"},
+		{[]string{"x", "a b", "b c", "c a x"}, "ordering cycle: a -> b -> c -> a"},
+	} {
+		var steps []*step
+		byName := map[string]*step{}
+		for _, s := range tt.steps {
+			f := strings.Fields(s)
+			st := &step{name: f[0], after: f[1:]}
+			steps = append(steps, st)
+			byName[st.name] = st
+		}
+		got := ""
+		if err := checkCycles(steps, byName); err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("checkCycles(%q) = %q, want %q", tt.steps, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// Strict configures strict mode, in which a failed rule marks the
+// window so the failure cannot be missed.
+type Strict struct {
+	Enabled bool
+	// Banner, if set, is a line inserted at the top of the window, with
+	// %s replaced by the failure, such as "// FAILED: %s". Otherwise
+	// the window is only marked dirty.
+	Banner string
+}
+
+// strictFail marks window id, showing the file name, as failing rule
+// with err, in the main loop. runSteps calls it only once the put's
+// formatting is applied, so a reformat does not remove the banner.
+func strictFail(id int, name, rule string, err error) {
+	configMu.RLock()
+	s := config.Strict
+	configMu.RUnlock()
+	if !s.Enabled || observing() {
+		return
+	}
+	go func() {
+		mainFuncs <- func() {
+			w, err2 := acme.Open(id, nil)
+			if err2 != nil {
+				log.Print(err2)
+				return
+			}
+			defer w.CloseFiles()
+			if s.Banner == "" {
+				w.Ctl("dirty")
+				return
+			}
+			ws := getWindow(id)
+			body, err2 := w.ReadAll("body")
+			if err2 != nil {
+				log.Print(err2)
+				return
+			}
+			banner := bannerLine(s.Banner, rule, err)
+			if err := w.Addr("%s", bannerAddr(body, ws.banner)); err != nil {
+				log.Print(err)
+				return
+			}
+			w.Write("data", []byte(banner))
+			ws.banner, ws.bannerRule = banner, rule
+		}
+	}()
+}
+
+// strictPass removes the banner strictFail put in window id, showing
+// the file name, once rule, the rule it was for, succeeds. A banner
+// that has since been edited or moved is left alone.
+func strictPass(id int, name, rule string) {
+	go func() {
+		mainFuncs <- func() {
+			ws := getWindow(id)
+			if ws.banner == "" || ws.bannerRule != rule {
+				return
+			}
+			banner := ws.banner
+			ws.banner, ws.bannerRule = "", ""
+			w, err := acme.Open(id, nil)
+			if err != nil {
+				log.Print(err)
+				return
+			}
+			defer w.CloseFiles()
+			body, err := w.ReadAll("body")
+			if err != nil {
+				log.Print(err)
+				return
+			}
+			if bannerAddr(body, banner) != "1" {
+				return
+			}
+			if err := w.Addr("1"); err != nil {
+				log.Print(err)
+				return
+			}
+			w.Write("data", nil)
+		}
+	}()
+}
+
+// bannerLine returns the banner line, with its newline, for rule
+// failing with err, formatted by format.
+func bannerLine(format, rule string, err error) string {
+	msg := strings.Join(strings.Fields(rule+": "+err.Error()), " ")
+	return fmt.Sprintf(format, msg) + "\n"
+}
+
+// bannerAddr returns the address in body at which to write a banner:
+// "1", replacing it, if the first line is exactly old, the banner
+// written before, and "#0", inserting a line, otherwise.
+func bannerAddr(body []byte, old string) string {
+	if old != "" && strings.HasPrefix(string(body), old) {
+		return "1"
+	}
+	return "#0"
+}
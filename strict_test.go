@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBannerLine(t *testing.T) {
+	for _, tt := range []struct {
+		format, rule, err string
+		want              string
+	}{
+		{"// FAILED: %s", "gofmt", "exit status 2", "// FAILED: gofmt: exit status 2\n"},
+		{"%s", "vet", "exit status 1", "vet: exit status 1\n"},
+		{"# %s", "lint", "line one\n\tline two", "# lint: line one line two\n"},
+	} {
+		if got := bannerLine(tt.format, tt.rule, errors.New(tt.err)); got != tt.want {
+			t.Errorf("bannerLine(%q, %q, %q) = %q, want %q", tt.format, tt.rule, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBannerAddr(t *testing.T) {
+	const banner = "// FAILED: gofmt: exit status 2\n"
+	for _, tt := range []struct {
+		body, old string
+		want      string
+	}{
+		// No banner written before: insert, even over a first line
+		// that looks like one.
+		{"package main\n", "", "#0"},
+		{banner + "package main\n", "", "#0"},
+		{"// Copyright 2020\npackage main\n", "", "#0"},
+		// The banner written before is still the first line.
+		{banner + "package main\n", banner, "1"},
+		{banner, banner, "1"},
+		// It was edited, moved, or removed.
+		{"// FAILED: gofmt: exit status 2 (see log)\npackage main\n", banner, "#0"},
+		{"package main\n" + banner, banner, "#0"},
+		{"package main\n", banner, "#0"},
+		{"", banner, "#0"},
+	} {
+		if got := bannerAddr([]byte(tt.body), tt.old); got != tt.want {
+			t.Errorf("bannerAddr(%q, %q) = %q, want %q", tt.body, tt.old, got, tt.want)
+		}
+	}
+}
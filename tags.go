@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tags configures the ctags builtin hook, which keeps a project's tags
+// file up to date.
+type Tags struct {
+	// File is the tags file, relative to the project root. Defaults to
+	// tags.
+	File string
+	// Root holds file names, like .git, marking the project root.
+	// Defaults to .git.
+	Root []string
+}
+
+// tagsMu serializes updates of tags files by hooks running at once.
+var tagsMu sync.Mutex
+
+// tagsPath returns the path of the tags file for name and the
+// directory paths in it are relative to.
+func (t Tags) tagsPath(name string) (file, root string) {
+	markers := t.Root
+	if len(markers) == 0 {
+		markers = []string{".git"}
+	}
+	root = projectRoot(filepath.Dir(name), markers)
+	file = t.File
+	if file == "" {
+		file = "tags"
+	}
+	return filepath.Join(root, file), root
+}
+
+// ctags replaces the entries for name in its project's tags file with
+// fresh ones. The entries are made by the hook's cmd, if set, which
+// must print them for the file given as $name, or by universal ctags.
+func ctags(ctx context.Context, h *Hook, name string) ([]byte, error) {
+	file, root := h.Tags.tagsPath(name)
+	rel, err := filepath.Rel(root, name)
+	if err != nil {
+		return nil, err
+	}
+	c := h.Command
+	if c.Cmd == "" {
+		c = Command{Cmd: "ctags", Args: []string{"-f", "-", "--fields=+n", "$name"}, Stdout: true}
+	}
+	c.Dir = root
+	out, err := c.runContext(ctx, name, rel, nil)
+	if err != nil {
+		return out, err
+	}
+
+	tagsMu.Lock()
+	defer tagsMu.Unlock()
+	old, err := ioutil.ReadFile(file)
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
+		return nil, err
+	}
+	var header, entries []string
+	for _, l := range strings.SplitAfter(string(old), "\n") {
+		switch {
+		case l == "":
+		case strings.HasPrefix(l, "!_"):
+			header = append(header, l)
+		case tagFile(l) != rel:
+			entries = append(entries, l)
+		}
+	}
+	for _, l := range strings.SplitAfter(string(out), "\n") {
+		if l != "" && !strings.HasPrefix(l, "!_") {
+			if !strings.HasSuffix(l, "\n") {
+				l += "\n"
+			}
+			entries = append(entries, l)
+		}
+	}
+	sort.Strings(entries)
+	if len(header) == 0 {
+		header = []string{"!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted/\n"}
+	}
+	data := []byte(strings.Join(header, "") + strings.Join(entries, ""))
+	if missing {
+		return nil, ioutil.WriteFile(file, data, 0666)
+	}
+	return nil, writeFile(file, data)
+}
+
+// tagFile returns the file field of the tags line l.
+func tagFile(l string) string {
+	f := strings.SplitN(l, "\t", 3)
+	if len(f) < 2 {
+		return ""
+	}
+	return f[1]
+}
+
+// tagLookup is the tag control command. It lists the definitions of a
+// symbol found in the tags file of the project containing a file, as
+// file:line addresses, and plumbs the definition if there is only one.
+func tagLookup(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", errors.New("usage: tag symbol file")
+	}
+	sym, name := args[0], args[1]
+	cfg, err := configFor(name)
+	if err != nil {
+		return "", err
+	}
+	var t Tags
+	for _, h := range cfg.Hook {
+		if h.Builtin == "ctags" {
+			if matched, _ := h.matches(name); matched {
+				t = h.Tags
+				break
+			}
+		}
+	}
+	file, root := t.tagsPath(name)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	var addrs []string
+	for _, l := range strings.Split(string(data), "\n") {
+		f := strings.SplitN(l, "\t", 3)
+		if len(f) < 3 || f[0] != sym {
+			continue
+		}
+		path := f[1]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		addrs = append(addrs, fmt.Sprintf("%s:%d", path, tagLine(path, f[2])))
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("tag %s: not found", sym)
+	}
+	if len(addrs) == 1 {
+		if out, err := exec.Command("9", "plumb", addrs[0]).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("plumb: %v: %s", err, bytes.TrimSpace(out))
+		}
+	}
+	return strings.Join(addrs, "\n"), nil
+}
+
+// tagLine returns the line of the file path that a tags entry's
+// address, from its third field on, refers to: a line number, a line
+// field from --fields=+n, or a /^pattern$/ search. It returns 1 if the
+// line cannot be found.
+func tagLine(path, rest string) int {
+	addr := rest
+	if i := strings.Index(rest, `;"`); i >= 0 {
+		addr = rest[:i]
+		for _, field := range strings.Split(rest[i+2:], "\t") {
+			if strings.HasPrefix(field, "line:") {
+				if n, err := strconv.Atoi(field[len("line:"):]); err == nil {
+					return n
+				}
+			}
+		}
+	}
+	if n, err := strconv.Atoi(addr); err == nil {
+		return n
+	}
+	if len(addr) < 2 || (addr[0] != '/' && addr[0] != '?') {
+		return 1
+	}
+	pat := addr[1 : len(addr)-1]
+	anchored := strings.HasPrefix(pat, "^")
+	pat = strings.TrimPrefix(pat, "^")
+	pat = strings.TrimSuffix(pat, "$")
+	pat = strings.NewReplacer(`\/`, `/`, `\\`, `\`, `\?`, `?`).Replace(pat)
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 1
+	}
+	for i, l := range strings.Split(string(src), "\n") {
+		if l == pat || !anchored && strings.Contains(l, pat) || anchored && strings.HasPrefix(l, pat) {
+			return i + 1
+		}
+	}
+	return 1
+}
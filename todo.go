@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// Todo configures the +TODO windows, which list the lines of a project
+// matching task markers like TODO.
+type Todo struct {
+	// Matcher limits the files scanned. Empty scans every file.
+	Matcher
+	// Patterns hold regular expressions marking a task. They default
+	// to TODO, FIXME, and XXX as words.
+	Patterns []string
+	// Root holds file names, like .git, marking a project's root
+	// directory. Defaults to .git.
+	Root     []string
+	patterns []*regexp.Regexp
+}
+
+// maxTodoFile is the size above which files are not scanned.
+const maxTodoFile = 1 << 20
+
+// todoWindows holds the open +TODO windows by project root. It is used
+// only by the main loop.
+var todoWindows = map[string]*acme.Win{}
+
+// check compiles t's patterns.
+func (t *Todo) check() error {
+	if len(t.Patterns) == 0 {
+		t.Patterns = []string{`\b(TODO|FIXME|XXX)\b`}
+	}
+	if len(t.Root) == 0 {
+		t.Root = []string{".git"}
+	}
+	t.patterns = nil
+	for _, p := range t.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("todo: pattern %q: %s", p, err)
+		}
+		t.patterns = append(t.patterns, re)
+	}
+	return t.compileMatch()
+}
+
+// openTodo is the todo control command. It opens, or refreshes, the
+// +TODO window of the project containing the given file or directory.
+func openTodo(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: todo file")
+	}
+	root := todoRoot(args[0])
+	if todoWindows[root] == nil {
+		w, err := newWindow(filepath.Join(root, "+TODO"))
+		if err != nil {
+			return "", err
+		}
+		w.Write("tag", []byte(" Get"))
+		todoWindows[root] = w
+		go todoEvents(root, w)
+	}
+	refreshTodo(root)
+	return "ok", nil
+}
+
+// todoRoot returns the project root of name.
+func todoRoot(name string) string {
+	dir := name
+	if info, err := os.Stat(name); err != nil || !info.IsDir() {
+		dir = filepath.Dir(name)
+	}
+	configMu.RLock()
+	markers := config.Todo.Root
+	configMu.RUnlock()
+	return projectRoot(dir, markers)
+}
+
+// todoSaved refreshes the +TODO window, if open, of the project
+// containing the saved file name.
+func todoSaved(name string) {
+	if len(todoWindows) == 0 {
+		return
+	}
+	if root := todoRoot(name); todoWindows[root] != nil {
+		refreshTodo(root)
+	}
+}
+
+// refreshTodo rescans the project at root in the background and
+// rewrites its +TODO window.
+func refreshTodo(root string) {
+	configMu.RLock()
+	t := config.Todo
+	configMu.RUnlock()
+	go func() {
+		out, err := scanTodo(root, &t)
+		mainFuncs <- func() {
+			w := todoWindows[root]
+			if w == nil {
+				return
+			}
+			if err != nil {
+				emitError(root, err)
+				return
+			}
+			w.Addr(",")
+			w.Write("data", out)
+			w.Ctl("clean")
+			w.Addr("#0")
+			w.Ctl("dot=addr")
+			w.Ctl("show")
+		}
+	}()
+}
+
+// scanTodo returns the lines of the files under root matching t's
+// patterns, as file:line addresses relative to root.
+func scanTodo(root string, t *Todo) ([]byte, error) {
+	files, err := trackedFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	for _, name := range files {
+		if !t.selects(name) {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxTodoFile {
+			continue
+		}
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		if isBinary(src) {
+			continue
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			rel = name
+		}
+		sc := bufio.NewScanner(bytes.NewReader(src))
+		sc.Buffer(nil, maxTodoFile)
+		for n := 1; sc.Scan(); n++ {
+			for _, re := range t.patterns {
+				if re.Match(sc.Bytes()) {
+					fmt.Fprintf(&b, "%s:%d: %s\n", rel, n, strings.TrimSpace(sc.Text()))
+					break
+				}
+			}
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// todoEvents handles the events of the +TODO window of root. Get
+// rescans the project.
+func todoEvents(root string, w *acme.Win) {
+	for e := range w.EventChan() {
+		if (e.C2 == 'x' || e.C2 == 'X') && string(e.Text) == "Get" {
+			mainFuncs <- func() { refreshTodo(root) }
+			continue
+		}
+		w.WriteEvent(e)
+	}
+	mainFuncs <- func() { delete(todoWindows, root) }
+}
+
+// isBinary reports whether src looks like binary data: whether a NUL
+// byte is among its first 512 bytes.
+func isBinary(src []byte) bool {
+	if len(src) > 512 {
+		src = src[:512]
+	}
+	return bytes.IndexByte(src, 0) >= 0
+}
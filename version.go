@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	versionsMu sync.Mutex
+	// versions holds the first line of each command's version output,
+	// keyed by rule name.
+	versions = map[string]string{}
+)
+
+// recordVersion looks up, once per rule, the version of the command
+// run by c and reports it. The lookup runs in the background.
+func recordVersion(rule string, c *Command) {
+	if c.Cmd == "" {
+		return
+	}
+	versionsMu.Lock()
+	_, ok := versions[rule]
+	if !ok {
+		versions[rule] = ""
+	}
+	versionsMu.Unlock()
+	if ok {
+		return
+	}
+	go func() {
+		v := commandVersion(c)
+		versionsMu.Lock()
+		versions[rule] = v
+		versionsMu.Unlock()
+		emit(Event{Event: "version", Rule: rule, Outcome: "ok", Message: "version " + v})
+	}()
+}
+
+// commandVersion runs c's command with its version arguments, by
+// default --version, and returns the first line of output.
+func commandVersion(c *Command) string {
+	bin, err := lookCmd(c.Cmd, "")
+	if err != nil {
+		return "unknown"
+	}
+	args := c.VersionArgs
+	if len(args) == 0 {
+		args = []string{"--version"}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, bin, args...).CombinedOutput()
+	if err != nil {
+		return "unknown"
+	}
+	if i := bytes.IndexByte(out, '\n'); i >= 0 {
+		out = out[:i]
+	}
+	if v := string(bytes.TrimSpace(out)); v != "" {
+		return v
+	}
+	return "unknown"
+}
+
+// ruleVersion returns the recorded version of rule's command, if any.
+func ruleVersion(rule string) string {
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+	return versions[rule]
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// warmed records, by rule name and project root, the warm rules that
+// have been started.
+var warmed = map[string]bool{}
+
+// warm starts, in the background, each warm rule matching name that
+// has not yet run for the file's project.
+func warm(name string) {
+	cfg, err := configFor(name)
+	if err != nil {
+		return
+	}
+	for _, r := range cfg.Warm {
+		if disabled[r.Name] {
+			continue
+		}
+		if matched, _ := r.matches(name); !matched {
+			continue
+		}
+		root := projectRoot(filepath.Dir(name), r.Root)
+		key := r.Name + "\x00" + root
+		if warmed[key] {
+			continue
+		}
+		warmed[key] = true
+		recordMatches([]string{r.Name})
+		c := r.Command
+		if c.Dir == "" {
+			c.Dir = root
+		}
+		go func(r *Warm) {
+			start := time.Now()
+			out, err := c.run(name, nil)
+			e := Event{
+				Time:        time.Now(),
+				Event:       "warm",
+				File:        root,
+				Rule:        r.Name,
+				Duration:    time.Since(start).Seconds(),
+				Outcome:     "ok",
+				Diagnostics: string(out),
+			}
+			if err != nil {
+				e.Outcome = "failed"
+				e.Message = err.Error()
+			}
+			emit(e)
+		}(r)
+	}
+}
+
+// projectRoot returns the nearest directory at or above dir containing
+// one of the marker files, or dir if there is none.
+func projectRoot(dir string, markers []string) string {
+	for d := dir; ; {
+		for _, m := range markers {
+			if _, err := os.Stat(filepath.Join(d, m)); err == nil {
+				return d
+			}
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"os"
+	"sync"
+
+	"9fans.net/go/acme"
+)
+
+var cleanupFlag = flag.Bool("cleanup-on-exit", false, "delete the windows acmewatch created when it exits")
+
+// window is the state kept for an acme window between events.
+type window struct {
+	// putSum is the checksum of the file at the last put.
+	putSum [sha256.Size]byte
+	puts   int
+	// name is the window's name as of its last event.
+	name string
+
+	// formattedSum is the checksum of the last contents formatted by
+	// formattedBy, so a put of the same contents can skip it.
+	formattedSum [sha256.Size]byte
+	formattedBy  *Formatter
+
+	// history holds the last formatting changes applied, oldest
+	// first.
+	history []applied
+	// autoputSum is the checksum of the contents last written by an
+	// autoput, whose put event is not formatted again.
+	autoputSum *[sha256.Size]byte
+	// putTaken is set once acmewatch handles the window's Puts
+	// itself, as for encrypted files.
+	putTaken bool
+	// banner is the strict mode banner line last inserted, for the
+	// rule bannerRule, or empty if there is none.
+	banner     string
+	bannerRule string
+}
+
+var windowState = map[int]*window{}
+
+func getWindow(id int) *window {
+	w := windowState[id]
+	if w == nil {
+		w = new(window)
+		windowState[id] = w
+	}
+	return w
+}
+
+// recordPut records the put of contents to window id and reports
+// whether they differ from the previous put's, as on a real save of a
+// dirty window rather than a Put of an unchanged one.
+func recordPut(id int, contents []byte) bool {
+	w := getWindow(id)
+	sum := sha256.Sum256(contents)
+	changed := w.puts == 0 || sum != w.putSum
+	w.putSum = sum
+	w.puts++
+	return changed
+}
+
+// setFormatted records that contents are already formatted by fm.
+func (w *window) setFormatted(fm *Formatter, contents []byte) {
+	w.formattedSum = sha256.Sum256(contents)
+	w.formattedBy = fm
+}
+
+// isFormatted reports whether contents are known to be formatted by fm.
+// Formatters are replaced when the config is reread, which forgets
+// what they formatted.
+func (w *window) isFormatted(fm *Formatter, contents []byte) bool {
+	return w.formattedBy == fm && w.formattedSum == sha256.Sum256(contents)
+}
+
+var (
+	createdMu sync.Mutex
+	created   []*acme.Win
+)
+
+// newWindow creates a window named name and remembers it so it can be
+// deleted at exit.
+func newWindow(name string) (*acme.Win, error) {
+	w, err := acme.New()
+	if err != nil {
+		return nil, err
+	}
+	w.Name("%s", name)
+	createdMu.Lock()
+	created = append(created, w)
+	createdMu.Unlock()
+	return w, nil
+}
+
+// deleteCreated deletes every window made by newWindow that still
+// exists.
+func deleteCreated() {
+	createdMu.Lock()
+	defer createdMu.Unlock()
+	for _, w := range created {
+		w.Del(true)
+	}
+	created = nil
+}
+
+// aliases returns the other windows showing the file name under a
+// different name, such as through a symlink, and with the same_name
+// policy "all" those under the same name too.
+func aliases(id int, name string) []acme.WinInfo {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil
+	}
+	wins, err := acme.Windows()
+	if err != nil {
+		return nil
+	}
+	var same []acme.WinInfo
+	for _, wi := range wins {
+		if wi.ID == id || wi.Name == "" || (wi.Name == name && config.SameName != "all") {
+			continue
+		}
+		if other, err := os.Stat(wi.Name); err == nil && !other.IsDir() && os.SameFile(info, other) {
+			same = append(same, wi)
+		}
+	}
+	return same
+}
+
+// bodyEquals reports whether the body of window id is text.
+func bodyEquals(id int, text []byte) bool {
+	body, err := windowBody(id)
+	return err == nil && bytes.Equal(body, text)
+}
+
+// windowBody returns the body of window id. Rules read it rather than
+// the file so they see exactly what was put, even under another name or
+// before a slow file system has settled.
+func windowBody(id int) ([]byte, error) {
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer w.CloseFiles()
+	return w.ReadAll("body")
+}
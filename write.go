@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var backupFlag = flag.String("backup", "", "when writing a file to disk, keep the original with this `suffix`")
+
+// writeFile atomically replaces the contents of name with data by
+// writing a temporary file in the same directory and renaming it over
+// name. The mode and, where possible, ownership of name are kept. If
+// name is a symlink the file it links to is replaced, and the link is
+// kept.
+func writeFile(name string, data []byte) error {
+	name, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if *backupFlag != "" {
+		old, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(name+*backupFlag, old, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".acmewatch-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, info.Mode()); err != nil {
+		return err
+	}
+	chown(tmp, info)
+	return os.Rename(tmp, name)
+}